@@ -0,0 +1,352 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type QuizSummary struct {
+	QuizId          string
+	Name            string
+	ActiveQuestions int64
+	Contestants     int64
+}
+
+func listQuizzes(orgId string) ([]QuizSummary, error) {
+	db, err := openDatabase()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT quiz_id, name,
+		(SELECT COUNT(*) FROM quiz_questions WHERE quiz_questions.quiz_id = quizzes.quiz_id AND active = 1) AS active_questions,
+		(SELECT COUNT(*) FROM scores WHERE scores.quiz_id = quizzes.quiz_id) AS contestants
+		FROM quizzes
+		WHERE org_id = ?
+		ORDER BY quiz_id`, orgId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var quizzes []QuizSummary
+	for rows.Next() {
+		var quiz QuizSummary
+		if err := rows.Scan(&quiz.QuizId, &quiz.Name, &quiz.ActiveQuestions, &quiz.Contestants); err != nil {
+			return nil, err
+		}
+		quizzes = append(quizzes, quiz)
+	}
+
+	return quizzes, rows.Err()
+}
+
+func quizExists(quizId string) (bool, error) {
+	db, err := openDatabase()
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM quizzes WHERE quiz_id = ?", quizId).Scan(&count)
+	return count > 0, err
+}
+
+// quiz settings that can be changed after creation, mapped to whether the value is a true/false flag
+var quizSettings = map[string]bool{
+	"name":                false,
+	"shuffle_questions":   true,
+	"shuffle_answers":     true,
+	"sample_size":         false,
+	"sample_stratify":     false,
+	"negative_marking":    false,
+	"speed_bonus":         false,
+	"speed_bonus_seconds": false,
+	"streak_bonus":        false,
+	"tie_breaker":         false,
+	"estimate_question":   false,
+	"estimate_answer":     false,
+	"jokers":              true,
+	"fifty_fifty":         true,
+	"locale":              false,
+	"integrity_checks":    true,
+	"max_group_size":      false,
+	"proof_of_work":       true,
+}
+
+func validateQuizSetting(column string, value string) error {
+	switch column {
+	case "name":
+		if strings.TrimSpace(value) == "" {
+			return errors.New("quiz name can't be empty")
+		}
+	case "speed_bonus_seconds":
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			return fmt.Errorf("speed bonus seconds must be 0 (off) or more, got %q", value)
+		}
+	case "sample_size":
+		size, err := strconv.Atoi(value)
+		if err != nil || size < 0 {
+			return fmt.Errorf("sample size must be 0 (all questions) or more, got %q", value)
+		}
+	case "max_group_size":
+		size, err := strconv.Atoi(value)
+		if err != nil || size < 0 {
+			return fmt.Errorf("max group size must be 0 (no limit) or more, got %q", value)
+		}
+	case "sample_stratify":
+		return validateSampleStratify(value)
+	case "negative_marking", "speed_bonus", "streak_bonus":
+		amount, err := strconv.ParseFloat(value, 64)
+		if err != nil || amount < 0 {
+			return fmt.Errorf("%s must be 0 (off) or more, got %q", strings.ReplaceAll(column, "_", " "), value)
+		}
+	case "estimate_answer":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("estimate answer must be a number, got %q", value)
+		}
+	case "tie_breaker":
+		return validateTieBreaker(value)
+	case "locale":
+		return validateLocale(value)
+	}
+	return nil
+}
+
+// changes maps column names to their new values, only known quiz settings are accepted
+func updateQuiz(quizId string, changes map[string]interface{}) error {
+	var columns []string
+	for column := range changes {
+		if _, found := quizSettings[column]; !found {
+			return fmt.Errorf("unknown quiz setting %s", column)
+		}
+		columns = append(columns, column)
+	}
+	if len(columns) == 0 {
+		return errors.New("no changes to apply")
+	}
+	sort.Strings(columns)
+
+	var setClauses []string
+	var args []interface{}
+	for _, column := range columns {
+		setClauses = append(setClauses, column+" = ?")
+		args = append(args, changes[column])
+	}
+	args = append(args, quizId)
+
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	result, err := db.Exec("UPDATE quizzes SET "+strings.Join(setClauses, ", ")+" WHERE quiz_id = ?", args...)
+	if err != nil {
+		return err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return fmt.Errorf("no quiz found with ID %s", quizId)
+	}
+
+	return nil
+}
+
+// removes the quiz, its rounds and every contestant's score, its questions stay in the bank
+func deleteQuiz(quizId string) error {
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM quizzes WHERE quiz_id = ?", quizId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		tx.Rollback()
+		return fmt.Errorf("no quiz found with ID %s", quizId)
+	}
+
+	for _, query := range []string{
+		"DELETE FROM quiz_questions WHERE quiz_id = ?",
+		"DELETE FROM answers WHERE quiz_id = ?",
+		"DELETE FROM contestant_questions WHERE contestant_id IN (SELECT contestant_id FROM scores WHERE quiz_id = ?)",
+		"DELETE FROM contestant_rounds WHERE contestant_id IN (SELECT contestant_id FROM scores WHERE quiz_id = ?)",
+		"DELETE FROM contestant_powerups WHERE contestant_id IN (SELECT contestant_id FROM scores WHERE quiz_id = ?)",
+		"DELETE FROM integrity_events WHERE quiz_id = ?",
+		"DELETE FROM rounds WHERE quiz_id = ?",
+		"DELETE FROM group_schedules WHERE quiz_id = ?",
+		"DELETE FROM admin_roles WHERE quiz_id = ?",
+		"DELETE FROM quiz_themes WHERE quiz_id = ?",
+		"DELETE FROM quiz_feedback WHERE quiz_id = ?",
+		"DELETE FROM scores WHERE quiz_id = ?",
+	} {
+		if _, err := tx.Exec(query, quizId); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// changes maps column names to their new values, only known bank question columns are accepted
+func updateQuestion(questionId int64, changes map[string]interface{}) error {
+	allowedColumns := map[string]bool{
+		"question":       true,
+		"answer_1":       true,
+		"answer_2":       true,
+		"answer_3":       true,
+		"answer_4":       true,
+		"correct_answer": true,
+		"category":       true,
+		"difficulty":     true,
+		"author":         true,
+	}
+
+	var columns []string
+	for column := range changes {
+		if !allowedColumns[column] {
+			return fmt.Errorf("unknown question field %s", column)
+		}
+		columns = append(columns, column)
+	}
+	if len(columns) == 0 {
+		return errors.New("no changes to apply")
+	}
+	sort.Strings(columns)
+
+	var setClauses []string
+	var args []interface{}
+	for _, column := range columns {
+		setClauses = append(setClauses, column+" = ?")
+		args = append(args, changes[column])
+	}
+	args = append(args, questionId)
+
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	result, err := db.Exec("UPDATE questions SET "+strings.Join(setClauses, ", ")+" WHERE question_id = ?", args...)
+	if err != nil {
+		return err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return fmt.Errorf("no question found with ID %d", questionId)
+	}
+
+	return nil
+}
+
+func listGroups(quizId string) ([]string, error) {
+	db, err := openDatabase()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT DISTINCT `group` FROM scores WHERE quiz_id = ? ORDER BY `group`", quizId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []string
+	for rows.Next() {
+		var group string
+		if err := rows.Scan(&group); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	return groups, rows.Err()
+}
+
+// a group exists once someone has joined it or it's been given its own schedule
+func groupExists(quizId string, group string) (bool, error) {
+	rows, err := makeDatabaseQuery(`SELECT (SELECT COUNT(*) FROM scores WHERE quiz_id = ? AND "group" = ?)
+		+ (SELECT COUNT(*) FROM group_schedules WHERE quiz_id = ? AND "group" = ?) AS found`,
+		quizId, strings.ToLower(group), quizId, strings.ToLower(group))
+	if err != nil {
+		return false, err
+	}
+	return rows[0]["found"].(int64) > 0, nil
+}
+
+// removes every contestant in the group so it can be reused, returns the number removed
+func resetGroup(quizId string, group string) (int64, error) {
+	db, err := openDatabase()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, table := range []string{"answers", "contestant_questions", "contestant_rounds", "contestant_powerups", "integrity_events"} {
+		_, err = tx.Exec("DELETE FROM "+table+" WHERE contestant_id IN (SELECT contestant_id FROM scores WHERE quiz_id = ? AND `group` = ?)", quizId, strings.ToLower(group))
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	result, err := tx.Exec("DELETE FROM scores WHERE quiz_id = ? AND `group` = ?", quizId, strings.ToLower(group))
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	removed, _ := result.RowsAffected()
+	return removed, tx.Commit()
+}
+
+func removeContestant(contestantId string) (int64, error) {
+	db, err := openDatabase()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, table := range []string{"answers", "contestant_questions", "contestant_rounds", "contestant_powerups", "integrity_events"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE contestant_id = ?", contestantId); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	result, err := tx.Exec("DELETE FROM scores WHERE contestant_id = ?", contestantId)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	removed, _ := result.RowsAffected()
+	return removed, tx.Commit()
+}
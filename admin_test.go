@@ -0,0 +1,324 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// a request from outside the server, so only its basic auth counts as logging in
+func adminRequest(t *testing.T, method string, target string, values url.Values, username string, key string) *http.Request {
+	t.Helper()
+	var body *strings.Reader
+	if values != nil {
+		body = strings.NewReader(values.Encode())
+	} else {
+		body = strings.NewReader("")
+	}
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Host = "quiz.example.com"
+	if values != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if username != "" {
+		req.SetBasicAuth(username, key)
+	}
+	return req
+}
+
+// logging in to the default organisation with its key makes a request the server's owner
+func serverOwnerKey(t *testing.T) string {
+	t.Helper()
+	key, err := rotateAdminKey(defaultOrganisation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newQuestionForm(quizId string) url.Values {
+	return url.Values{
+		"quiz_id":        {quizId},
+		"quiz_name":      {"Christmas"},
+		"sort_order":     {"1"},
+		"question":       {"What is the capital of France"},
+		"answer_1":       {"Lyon"},
+		"answer_2":       {"Paris"},
+		"answer_3":       {"Nice"},
+		"answer_4":       {"Lille"},
+		"correct_answer": {"2"},
+	}
+}
+
+func TestCreateQuestionAsServerOwner(t *testing.T) {
+	useTestDatabase(t)
+	key := serverOwnerKey(t)
+	server := newTestServer(t)
+	client := newTestClient(t)
+
+	status, _, body := do(t, client, adminRequest(t, http.MethodPost, server.URL+"/create-question/", newQuestionForm("christmas"), defaultOrganisation, key))
+	if status != http.StatusOK || !strings.Contains(body, "Question added successfully") {
+		t.Fatalf("got %d: %s", status, body)
+	}
+
+	contestant := Contestant{ContestantId: createContestant("christmas", "Rita", "legal"), QuizId: "christmas"}
+	quizName, question := getQuestionDetails("christmas", contestant, 1)
+	if quizName != "Christmas" || question.QuestionText != "What is the capital of France" || question.CorrectAnswer != 2 {
+		t.Errorf("got quiz %q with question %+v", quizName, question)
+	}
+
+	status, _, body = do(t, client, adminRequest(t, http.MethodPost, server.URL+"/create-question/", url.Values{"quiz_id": {"christmas"}, "question": {"Too short"}}, defaultOrganisation, key))
+	if status != http.StatusOK || !strings.Contains(body, `class="error"`) {
+		t.Errorf("invalid question: got %d: %s", status, body)
+	}
+}
+
+func TestCreateQuestionNeedsACorrectAnswer(t *testing.T) {
+	useTestDatabase(t)
+	key := serverOwnerKey(t)
+	server := newTestServer(t)
+	client := newTestClient(t)
+
+	for _, correct := range []string{"0", "5", "two", "4"} {
+		form := newQuestionForm("christmas")
+		form.Set("correct_answer", correct)
+		// the correct answer's slot left empty, as a question with three answers would
+		form.Set("answer_4", "")
+		status, _, body := do(t, client, adminRequest(t, http.MethodPost, server.URL+"/create-question/", form, defaultOrganisation, key))
+		if status != http.StatusOK || !strings.Contains(body, "The correct answer must be one of the four answers") {
+			t.Errorf("correct answer %s: got %d: %s", correct, status, body)
+		}
+	}
+	if exists, _ := quizExists("christmas"); exists {
+		t.Error("a quiz was created for a question that wasn't added")
+	}
+}
+
+func TestQuestionCommandsNeedACorrectAnswer(t *testing.T) {
+	useTestDatabase(t)
+	questionIds := addTestQuiz(t, "christmas", "Christmas", arithmeticQuestions)
+	id := strconv.FormatInt(questionIds[0], 10)
+	run := func(args ...string) error {
+		return runCommand(append([]string{"-db", databasePath}, args...))
+	}
+
+	if err := run("question", "add", "-question", "What is one plus one", "-answer-1", "2", "-answer-2", "3", "-correct-answer", "3"); err == nil {
+		t.Error("added a question whose correct answer is empty")
+	}
+	// the first question's correct answer is 2, answers 1 to 4 are filled in
+	if err := run("question", "edit", "-id", id, "-answer-2", ""); err == nil {
+		t.Error("emptied the correct answer")
+	}
+	if err := run("question", "edit", "-id", id, "-answer-4", "", "-correct-answer", "4"); err == nil {
+		t.Error("moved the correct answer to one being emptied")
+	}
+	if err := run("question", "edit", "-id", id, "-answer-4", ""); err != nil {
+		t.Errorf("emptying another answer: %v", err)
+	}
+	if err := run("question", "edit", "-id", id, "-correct-answer", "4"); err == nil {
+		t.Error("moved the correct answer to an empty one")
+	}
+	if err := run("question", "edit", "-id", id, "-answer-4", "7", "-correct-answer", "4"); err != nil {
+		t.Errorf("filling in an answer and making it correct: %v", err)
+	}
+}
+
+func TestOrganisationAdminPermissions(t *testing.T) {
+	useTestDatabase(t)
+	orgKey, err := createOrganisation("finance", "Finance", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	createQuiz("finance:christmas", "Christmas")
+	createQuiz("finance:easter", "Easter")
+	authorKey, err := addAdminUser("finance", "rita")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := grantRole("finance", RoleGrant{Username: "rita", Role: "author", QuizId: "finance:christmas"}); err != nil {
+		t.Fatal(err)
+	}
+	server := newTestServer(t)
+	client := newTestClient(t)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		values     url.Values
+		username   string
+		key        string
+		wantStatus int
+	}{
+		{"not logged in", http.MethodGet, "/org/finance/create-question/", nil, "", "", http.StatusUnauthorized},
+		{"wrong key", http.MethodGet, "/org/finance/create-question/", nil, "rita", "not-the-key", http.StatusUnauthorized},
+		{"another organisation's key", http.MethodGet, "/org/finance/create-question/", nil, "default", orgKey, http.StatusUnauthorized},
+		{"author adds to their quiz", http.MethodPost, "/org/finance/create-question/", newQuestionForm("christmas"), "rita", authorKey, http.StatusOK},
+		{"author adds to another quiz", http.MethodPost, "/org/finance/create-question/", newQuestionForm("easter"), "rita", authorKey, http.StatusForbidden},
+		{"author exports their quiz", http.MethodGet, "/org/finance/export/christmas/", nil, "rita", authorKey, http.StatusOK},
+		{"author exports another quiz", http.MethodGet, "/org/finance/export/easter/", nil, "rita", authorKey, http.StatusForbidden},
+		{"author resets a group", http.MethodPost, "/org/finance/reset-group/christmas/", url.Values{"group": {"legal"}}, "rita", authorKey, http.StatusForbidden},
+		{"owner resets a group", http.MethodPost, "/org/finance/reset-group/christmas/", url.Values{"group": {"legal"}}, "finance", orgKey, http.StatusOK},
+		// the backup has every organisation's data in it
+		{"organisation owner downloads a backup", http.MethodPost, "/org/finance/backup/", url.Values{}, "finance", orgKey, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, _, body := do(t, client, adminRequest(t, test.method, server.URL+test.path, test.values, test.username, test.key))
+			if status != test.wantStatus {
+				t.Errorf("got status %d, want %d: %s", status, test.wantStatus, body)
+			}
+		})
+	}
+
+	rows, err := makeDatabaseQuery("SELECT COUNT(*) AS count FROM quiz_questions WHERE quiz_id = ?", "finance:christmas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := rows[0]["count"].(int64); count != 1 {
+		t.Errorf("christmas has %d questions, want the one rita added", count)
+	}
+}
+
+func TestBackupDownloadAsServerOwner(t *testing.T) {
+	useTestDatabase(t)
+	key := serverOwnerKey(t)
+	server := newTestServer(t)
+
+	status, _, body := do(t, newTestClient(t), adminRequest(t, http.MethodPost, server.URL+"/backup/", url.Values{}, defaultOrganisation, key))
+	if status != http.StatusOK || !strings.HasPrefix(body, "SQLite format 3") {
+		t.Errorf("got status %d and %d bytes, want a SQLite database", status, len(body))
+	}
+}
+
+// the old ways in, a Host header naming the server and the admin form value from the templates, are only requests
+// without a login now
+func TestAdminShortcutsNeedALogin(t *testing.T) {
+	useTestDatabase(t)
+	key := serverOwnerKey(t)
+	server := newTestServer(t)
+	client := newTestClient(t)
+
+	spoofed := func(method string, path string, values url.Values, host string) *http.Request {
+		req := adminRequest(t, method, server.URL+path, values, "", "")
+		req.Host = host
+		return req
+	}
+	tests := []struct {
+		name       string
+		req        *http.Request
+		wantStatus int
+	}{
+		{"backup from a loopback host", spoofed(http.MethodPost, "/backup/", url.Values{}, "127.0.0.1"), http.StatusUnauthorized},
+		{"backup from a host naming loopback", spoofed(http.MethodPost, "/backup/", url.Values{}, "127.0.0.1.evil.com"), http.StatusUnauthorized},
+		{"backup with the admin form value", spoofed(http.MethodPost, "/backup/", url.Values{"admin": {"ihavethepower"}}, "quiz.example.com"), http.StatusUnauthorized},
+		{"question with the admin form value", spoofed(http.MethodPost, "/create-question/", url.Values{"admin": {"ihavethepower"}}, "quiz.example.com"), http.StatusUnauthorized},
+		{"question bank with the admin query", spoofed(http.MethodGet, "/question-bank/?admin=true", nil, "quiz.example.com"), http.StatusUnauthorized},
+		{"backup with the wrong key", adminRequest(t, http.MethodPost, server.URL+"/backup/", url.Values{}, defaultOrganisation, key+"x"), http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, _, body := do(t, client, test.req)
+			if status != test.wantStatus {
+				t.Errorf("got status %d, want %d", status, test.wantStatus)
+			}
+			if strings.HasPrefix(body, "SQLite format 3") {
+				t.Error("got a copy of the database")
+			}
+		})
+	}
+}
+
+func TestAddAdminUser(t *testing.T) {
+	useTestDatabase(t)
+	if _, err := createOrganisation("finance", "Finance", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := addAdminUser("finance", "rita")
+	if err != nil || key == "" {
+		t.Fatalf("got key %q and error %v", key, err)
+	}
+	if _, err := addAdminUser("finance", "rita"); err == nil {
+		t.Error("adding the same admin twice should fail")
+	}
+	if _, err := addAdminUser("finance", "finance"); err == nil {
+		t.Error("the organisation's ID is kept for its own admin key")
+	}
+	if _, err := addAdminUser("finance", "Rita Smith"); err == nil {
+		t.Error("user names can only be lower case letters, numbers and dashes")
+	}
+	if err := grantRole("finance", RoleGrant{Username: "rita", Role: "judge"}); err == nil {
+		t.Error("granting a role that doesn't exist should fail")
+	}
+	if err := grantRole("finance", RoleGrant{Username: "bob", Role: "viewer"}); err == nil {
+		t.Error("granting a role to someone who isn't an admin should fail")
+	}
+
+	rows, err := makeDatabaseQuery("SELECT key_hash FROM admin_users WHERE org_id = ? AND username = ?", "finance", "rita")
+	if err != nil || len(rows) != 1 {
+		t.Fatalf("got %d admins (%v)", len(rows), err)
+	}
+	if rows[0]["key_hash"].(string) == key {
+		t.Error("the key should only be stored hashed")
+	}
+}
+
+func TestCommandsStayInTheirOrganisation(t *testing.T) {
+	useTestDatabase(t)
+	previous := commandOrganisation
+	t.Cleanup(func() { commandOrganisation = previous })
+	if _, err := createOrganisation("finance", "Finance", ""); err != nil {
+		t.Fatal(err)
+	}
+	questionIds := addTestQuiz(t, "christmas", "Christmas", roundQuestions)
+	rounds, err := listRounds("christmas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roundId := strconv.FormatInt(rounds[0].RoundId, 10)
+	contestantId := createContestant("christmas", "Rita", "legal")
+	// the finance organisation has a quiz with the same ID as the default organisation's
+	if _, created := createQuiz("finance:christmas", "Christmas"); !created {
+		t.Fatal("creating finance's quiz")
+	}
+
+	commands := [][]string{
+		{"round", "update", "-id", roundId, "-title", "Renamed"},
+		{"round", "delete", "-id", roundId},
+		{"contestant", "remove", "-id", contestantId},
+		{"quiz", "remove-question", "-quiz", "christmas", "-question", strconv.FormatInt(questionIds[0], 10)},
+	}
+	for _, command := range commands {
+		if err := runCommand(append([]string{"-db", databasePath, "-org", "finance"}, command...)); err == nil {
+			t.Errorf("%s with -org finance changed the default organisation's quiz", strings.Join(command, " "))
+		}
+	}
+
+	rounds, _ = listRounds("christmas")
+	if len(rounds) != 2 || rounds[0].Title != "Warm up" {
+		t.Errorf("got rounds %+v, want them unchanged", rounds)
+	}
+	if countContestants(t, "christmas") != 1 || countQuizQuestions(t, "christmas") != 3 {
+		t.Error("the default organisation's contestant or question was removed")
+	}
+
+	if err := runCommand([]string{"-db", databasePath, "-org", defaultOrganisation, "round", "delete", "-id", roundId}); err != nil {
+		t.Errorf("the default organisation deleting its own round: %v", err)
+	}
+}
+
+func countQuizQuestions(t *testing.T, quizId string) int64 {
+	t.Helper()
+	rows, err := makeDatabaseQuery("SELECT COUNT(*) AS questions FROM quiz_questions WHERE quiz_id = ?", quizId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows[0]["questions"].(int64)
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+type OptionStats struct {
+	Number  int
+	Text    string
+	Count   int64
+	Percent float64
+	Correct bool
+}
+
+type QuestionStats struct {
+	QuestionId        int64
+	Order             int64
+	QuestionText      string
+	Responses         int64
+	PercentCorrect    float64
+	Options           []OptionStats
+	HasTiming         bool
+	MedianSeconds     float64
+	HasDiscrimination bool
+	Discrimination    float64
+	StoppedHere       int64
+}
+
+type QuizAnalytics struct {
+	QuizId      string
+	QuizName    string
+	Started     int64
+	Finished    int64
+	DroppedOff  int64
+	DropOffRate float64
+	Questions   []QuestionStats
+}
+
+type answerSample struct {
+	contestantId   string
+	questionId     int64
+	selectedAnswer int64
+	correct        bool
+	timeTaken      interface{}
+}
+
+// share of contestants at each end of the score distribution used for the discrimination index
+const discriminationGroupShare = 0.27
+
+func percentage(count int64, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(count) * 100 / float64(total)
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+// discrimination index is the proportion of the top scorers who got the question right minus the proportion of the bottom
+// scorers who did, values near 1 separate strong and weak contestants well, near 0 or negative means it doesn't. Only
+// contestants who were given the question count, as a pool gives each contestant some of the questions
+func discriminationIndex(question int64, ranked []string, answersByContestant map[string]map[int64]answerSample) (float64, bool) {
+	var given []string
+	for _, contestantId := range ranked {
+		if _, answered := answersByContestant[contestantId][question]; answered {
+			given = append(given, contestantId)
+		}
+	}
+	groupSize := int(float64(len(given))*discriminationGroupShare + 0.5)
+	if groupSize < 1 || groupSize*2 > len(given) {
+		return 0, false
+	}
+
+	proportionCorrect := func(contestants []string) float64 {
+		correct := 0
+		for _, contestantId := range contestants {
+			if answersByContestant[contestantId][question].correct {
+				correct++
+			}
+		}
+		return float64(correct) / float64(len(contestants))
+	}
+
+	top := given[:groupSize]
+	bottom := given[len(given)-groupSize:]
+	return proportionCorrect(top) - proportionCorrect(bottom), true
+}
+
+func getQuizAnalytics(quizId string) (QuizAnalytics, error) {
+	analytics := QuizAnalytics{QuizId: quizId}
+
+	quizResult, err := makeDatabaseQuery(`SELECT name,
+		(SELECT COUNT(*) FROM scores WHERE quiz_id = ? AND started IS NOT NULL) AS started,
+		(SELECT COUNT(*) FROM scores WHERE quiz_id = ? AND started IS NOT NULL AND finished IS NOT NULL) AS finished
+		FROM quizzes WHERE quiz_id = ?`, quizId, quizId, quizId)
+	if err != nil {
+		return analytics, err
+	}
+	if len(quizResult) == 0 {
+		return analytics, nil
+	}
+	analytics.QuizName = quizResult[0]["name"].(string)
+	analytics.Started = quizResult[0]["started"].(int64)
+	analytics.Finished = quizResult[0]["finished"].(int64)
+	analytics.DroppedOff = analytics.Started - analytics.Finished
+	analytics.DropOffRate = percentage(analytics.DroppedOff, analytics.Started)
+
+	questionRows, err := makeDatabaseQuery(`SELECT questions.question_id, quiz_questions.sort_order, question, answer_1, answer_2, answer_3, answer_4, correct_answer
+		FROM quiz_questions
+		INNER JOIN questions ON questions.question_id = quiz_questions.question_id
+		WHERE quiz_questions.quiz_id = ? AND quiz_questions.active = 1
+		ORDER BY quiz_questions.sort_order`, quizId)
+	if err != nil {
+		return analytics, err
+	}
+
+	answerRows, err := makeDatabaseQuery(`SELECT contestant_id, question_id, selected_answer, correct, time_taken_seconds
+		FROM answers WHERE quiz_id = ? ORDER BY answer_id`, quizId)
+	if err != nil {
+		return analytics, err
+	}
+
+	// only the first answer a contestant gives to a question counts
+	answersByContestant := map[string]map[int64]answerSample{}
+	answersByQuestion := map[int64][]answerSample{}
+	totalCorrect := map[string]int{}
+	for _, row := range answerRows {
+		sample := answerSample{
+			contestantId:   row["contestant_id"].(string),
+			questionId:     row["question_id"].(int64),
+			selectedAnswer: row["selected_answer"].(int64),
+			correct:        row["correct"].(int64) == 1,
+			timeTaken:      row["time_taken_seconds"],
+		}
+		if answersByContestant[sample.contestantId] == nil {
+			answersByContestant[sample.contestantId] = map[int64]answerSample{}
+		}
+		if _, answered := answersByContestant[sample.contestantId][sample.questionId]; answered {
+			continue
+		}
+		answersByContestant[sample.contestantId][sample.questionId] = sample
+		answersByQuestion[sample.questionId] = append(answersByQuestion[sample.questionId], sample)
+		if sample.correct {
+			totalCorrect[sample.contestantId]++
+		}
+	}
+
+	// contestants who gave up part way through would look like weak ones, so only those who finished are ranked
+	finishedRows, err := makeDatabaseQuery("SELECT contestant_id FROM scores WHERE quiz_id = ? AND finished IS NOT NULL", quizId)
+	if err != nil {
+		return analytics, err
+	}
+	var ranked []string
+	for _, row := range finishedRows {
+		if contestantId := row["contestant_id"].(string); answersByContestant[contestantId] != nil {
+			ranked = append(ranked, contestantId)
+		}
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if totalCorrect[ranked[i]] == totalCorrect[ranked[j]] {
+			return ranked[i] < ranked[j]
+		}
+		return totalCorrect[ranked[i]] > totalCorrect[ranked[j]]
+	})
+
+	// where did the people who gave up stop, keyed by the last question they answered
+	stoppedAfter := map[int64]int64{}
+	dropOffRows, err := makeDatabaseQuery(`SELECT (SELECT answers.question_id FROM answers WHERE answers.contestant_id = scores.contestant_id ORDER BY answer_id DESC LIMIT 1) AS last_question
+		FROM scores WHERE quiz_id = ? AND started IS NOT NULL AND finished IS NULL`, quizId)
+	if err != nil {
+		return analytics, err
+	}
+	for _, row := range dropOffRows {
+		if row["last_question"] != nil {
+			stoppedAfter[row["last_question"].(int64)]++
+		}
+	}
+
+	for _, row := range questionRows {
+		stats := QuestionStats{
+			QuestionId:   row["question_id"].(int64),
+			Order:        row["sort_order"].(int64),
+			QuestionText: row["question"].(string),
+		}
+		correctAnswer := row["correct_answer"].(int64)
+		samples := answersByQuestion[stats.QuestionId]
+		stats.Responses = int64(len(samples))
+		stats.StoppedHere = stoppedAfter[stats.QuestionId]
+
+		optionCounts := map[int64]int64{}
+		var correct int64
+		var timings []float64
+		for _, sample := range samples {
+			optionCounts[sample.selectedAnswer]++
+			if sample.correct {
+				correct++
+			}
+			if seconds, ok := sample.timeTaken.(float64); ok {
+				timings = append(timings, seconds)
+			}
+		}
+		stats.PercentCorrect = percentage(correct, stats.Responses)
+
+		for number := 1; number <= 4; number++ {
+			text, _ := row[fmt.Sprintf("answer_%d", number)].(string)
+			stats.Options = append(stats.Options, OptionStats{
+				Number:  number,
+				Text:    text,
+				Count:   optionCounts[int64(number)],
+				Percent: percentage(optionCounts[int64(number)], stats.Responses),
+				Correct: int64(number) == correctAnswer,
+			})
+		}
+
+		if len(timings) > 0 {
+			stats.HasTiming = true
+			stats.MedianSeconds = median(timings)
+		}
+
+		stats.Discrimination, stats.HasDiscrimination = discriminationIndex(stats.QuestionId, ranked, answersByContestant)
+
+		analytics.Questions = append(analytics.Questions, stats)
+	}
+
+	return analytics, nil
+}
+
+// handles GET /analytics/{quiz}/
+func quizAnalytics(w http.ResponseWriter, r *http.Request) {
+	quizId, _ := requestQuiz(r)
+	analytics, err := getQuizAnalytics(quizId)
+	if err != nil {
+		requestLogger(r).Error("Error getting analytics", "quiz_id", quizId, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if analytics.QuizName == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	tmpl, err := pageTemplates.get("analytics")
+	if err != nil {
+		requestLogger(r).Error("Error rendering template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+		"QuizTitle": analytics.QuizName,
+		"Theme":     requestTheme(r, quizId),
+		"Analytics": analytics,
+	})
+	if err != nil {
+		requestLogger(r).Error("Error rendering template", "error", err)
+	}
+}
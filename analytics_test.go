@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDiscriminationIndexCountsFinishedContestantsGivenTheQuestion(t *testing.T) {
+	useTestDatabase(t)
+	addTestQuiz(t, "analytics", "Analytics", arithmeticQuestions)
+
+	// as a pool would, the strong contestants weren't given the last question
+	for _, name := range []string{"Ann", "Bob", "Cat", "Dan"} {
+		addFinishedContestant(t, "analytics", name, "legal", []bool{true, true}, []float64{5, 5})
+	}
+	for _, name := range []string{"Eve", "Fay"} {
+		addFinishedContestant(t, "analytics", name, "legal", []bool{false, false, true}, []float64{5, 5, 5})
+	}
+	for _, name := range []string{"Gus", "Hal"} {
+		addFinishedContestant(t, "analytics", name, "legal", []bool{false, false, false}, []float64{5, 5, 5})
+	}
+	// people who gave up after getting the first question right, stopping early doesn't make them weak contestants
+	for _, name := range []string{"Ida", "Jo", "Kim", "Lou", "Max", "Ned"} {
+		contestantId := createContestant("analytics", name, "legal")
+		details := getContestantDetails(context.Background(), contestantId)
+		_, question := getQuestionDetails("analytics", details, 1)
+		if err := saveAnswer(context.Background(), details, question, 2, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	analytics, err := getQuizAnalytics("analytics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{1, 1, 1}
+	for i, stats := range analytics.Questions {
+		if !stats.HasDiscrimination || stats.Discrimination != want[i] {
+			t.Errorf("question %d: got discrimination %v (%v), want %v", i+1, stats.Discrimination, stats.HasDiscrimination, want[i])
+		}
+	}
+}
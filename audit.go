@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strings"
+)
+
+// a change made by an admin, from the web or the command line
+type AuditEntry struct {
+	At       string
+	Username string
+	Action   string
+	QuizId   string
+	Details  string
+}
+
+func recordAudit(orgId string, username string, action string, quizId string, details string) error {
+	_, err := makeDatabaseQuery("INSERT INTO audit_log(org_id, username, action, quiz_id, details) VALUES (?, ?, ?, ?, ?)",
+		orgId, username, action, quizId, details)
+	return err
+}
+
+// records a change made through an admin route, failing to record it doesn't stop the change
+func recordWebAudit(r *http.Request, action string, quizId string, details string) {
+	admin, _ := requestAdmin(r)
+	if err := recordAudit(requestOrganisation(r).OrgId, admin.Username, action, quizId, details); err != nil {
+		requestLogger(r).Error("Error recording audit entry", "action", action, "error", err)
+	}
+}
+
+// command line changes are recorded against the user running the command
+func commandUsername() string {
+	if user := os.Getenv("USER"); user != "" {
+		return "cli:" + user
+	}
+	return "cli"
+}
+
+// the quiz a command worked on, from its -quiz flag or the -id flag of the quiz commands
+func commandQuizId(command string, args []string) string {
+	quizFlag := "quiz"
+	if command == "quiz" {
+		quizFlag = "id"
+	}
+	for i, arg := range args {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name != quizFlag || !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		if hasValue {
+			return orgQuizId(value)
+		}
+		if i+1 < len(args) {
+			return orgQuizId(args[i+1])
+		}
+	}
+	return ""
+}
+
+// the organisation's audit trail, newest first, for one quiz if quizId isn't empty
+func listAudit(orgId string, quizId string, limit int) ([]AuditEntry, error) {
+	query := "SELECT at, username, action, quiz_id, details FROM audit_log WHERE org_id = ?"
+	args := []interface{}{orgId}
+	if quizId != "" {
+		query += " AND quiz_id = ?"
+		args = append(args, quizId)
+	}
+	rows, err := makeDatabaseQuery(query+" ORDER BY audit_id DESC LIMIT ?", append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []AuditEntry
+	for _, row := range rows {
+		entries = append(entries, AuditEntry{
+			At:       row["at"].(string),
+			Username: row["username"].(string),
+			Action:   row["action"].(string),
+			QuizId:   publicQuizId(row["quiz_id"].(string)),
+			Details:  row["details"].(string),
+		})
+	}
+	return entries, nil
+}
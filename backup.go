@@ -0,0 +1,269 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backups are named quiz-data-<UTC time>.db so they sort oldest first
+const (
+	backupPrefix     = "quiz-data-"
+	backupSuffix     = ".db"
+	backupTimeFormat = "20060102T150405Z"
+)
+
+// where backups go unless -backup-dir says otherwise, next to the database so they end up on the same volume
+func defaultBackupDir() string {
+	return filepath.Join(filepath.Dir(databasePath), "backups")
+}
+
+// writes a consistent copy of the database with VACUUM INTO, which doesn't stop contestants answering while it runs.
+// The copy is written under a temporary name first so a backup cut short is never mistaken for a whole one
+func backupDatabase(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	partial := path + ".partial"
+	os.Remove(partial)
+
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := db.Exec("VACUUM INTO ?", partial); err != nil {
+		os.Remove(partial)
+		return fmt.Errorf("backing up the database: %w", err)
+	}
+	return os.Rename(partial, path)
+}
+
+// backs up the database into dir and returns the backup's path
+func createBackup(dir string, now time.Time) (string, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, backupPrefix+now.UTC().Format(backupTimeFormat)+backupSuffix)
+	return path, backupDatabase(path)
+}
+
+type Backup struct {
+	Path    string
+	Created time.Time
+	Size    int64
+}
+
+// the backups in dir, oldest first. Other files in the directory are left alone
+func listBackups(dir string) ([]Backup, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []Backup
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, backupPrefix) || !strings.HasSuffix(name, backupSuffix) {
+			continue
+		}
+		created, err := time.Parse(backupTimeFormat, strings.TrimSuffix(strings.TrimPrefix(name, backupPrefix), backupSuffix))
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, Backup{Path: filepath.Join(dir, name), Created: created, Size: info.Size()})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Created.Before(backups[j].Created)
+	})
+	return backups, nil
+}
+
+// deletes all but the newest keep backups and returns the paths removed
+func pruneBackups(dir string, keep int) ([]string, error) {
+	backups, err := listBackups(dir)
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for len(backups) > keep {
+		if err := os.Remove(backups[0].Path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, backups[0].Path)
+		backups = backups[1:]
+	}
+	return removed, nil
+}
+
+// backs up the database every interval while the server runs, keeping the newest keep backups. Machines that are
+// stopped when idle may never run a full interval, so a backup is taken at start up if the last one is already due
+func runScheduledBackups(dir string, interval time.Duration, keep int) {
+	wait := time.Duration(0)
+	backups, err := listBackups(dir)
+	if err != nil {
+		slog.Error("Error listing backups", "dir", dir, "error", err)
+	}
+	if len(backups) > 0 {
+		wait = interval - time.Since(backups[len(backups)-1].Created)
+	}
+
+	for {
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+		wait = interval
+
+		start := time.Now()
+		path, err := createBackup(dir, start)
+		if err != nil {
+			slog.Error("Error backing up the database", "dir", dir, "error", err)
+			continue
+		}
+		slog.Info("Backed up the database", "path", path, "duration_ms", time.Since(start).Milliseconds())
+
+		removed, err := pruneBackups(dir, keep)
+		if err != nil {
+			slog.Error("Error removing old backups", "dir", dir, "error", err)
+		}
+		for _, path := range removed {
+			slog.Info("Removed old backup", "path", path)
+		}
+	}
+}
+
+// checks a file is an intact quiz database this version of the server can use, and returns its schema version
+func validateBackup(path string) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var integrity string
+	if err := db.QueryRow("PRAGMA integrity_check").Scan(&integrity); err != nil {
+		return 0, fmt.Errorf("%s isn't a SQLite database: %w", path, err)
+	}
+	if integrity != "ok" {
+		return 0, fmt.Errorf("%s failed its integrity check: %s", path, integrity)
+	}
+
+	var version int
+	if err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, fmt.Errorf("%s has no schema version, is it a quiz database? %w", path, err)
+	}
+	if version < 1 {
+		return 0, fmt.Errorf("%s has no migrations applied", path)
+	}
+	if version > latestSchemaVersion() {
+		return 0, fmt.Errorf("%s is at schema version %d, newer than this server's %d", path, version, latestSchemaVersion())
+	}
+	return version, nil
+}
+
+func copyFile(from string, to string) error {
+	source, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	destination, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(destination, source); err != nil {
+		destination.Close()
+		return err
+	}
+	if err := destination.Sync(); err != nil {
+		destination.Close()
+		return err
+	}
+	return destination.Close()
+}
+
+// replaces the database with a backup, after keeping a copy of the current one next to it. The server has to be
+// stopped first, a database with a journal left beside it is still in use or wasn't closed cleanly
+func restoreBackup(path string, now time.Time) (previous string, version int, err error) {
+	version, err = validateBackup(path)
+	if err != nil {
+		return "", 0, err
+	}
+	for _, suffix := range []string{"-journal", "-wal"} {
+		if _, err := os.Stat(databasePath + suffix); err == nil {
+			return "", 0, fmt.Errorf("%s%s exists, stop the server before restoring", databasePath, suffix)
+		}
+	}
+
+	if _, err := os.Stat(databasePath); err == nil {
+		previous = databasePath + ".before-restore-" + now.UTC().Format(backupTimeFormat)
+		if err := backupDatabase(previous); err != nil {
+			return "", 0, fmt.Errorf("keeping a copy of the current database: %w", err)
+		}
+	}
+
+	// copied next to the database and renamed over it so there's never a half written database in its place
+	restoring := databasePath + ".restoring"
+	os.Remove(restoring)
+	if err := copyFile(path, restoring); err != nil {
+		os.Remove(restoring)
+		return previous, 0, err
+	}
+	if err := os.Rename(restoring, databasePath); err != nil {
+		os.Remove(restoring)
+		return previous, 0, err
+	}
+	return previous, version, nil
+}
+
+// handles POST /backup/, downloads a snapshot of the whole database. Routed through requireServerOwner, as it has
+// every organisation's quizzes, results and admin key hashes in it
+func backupDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	dir, err := os.MkdirTemp("", "quiz-backup-")
+	if err != nil {
+		requestLogger(r).Error("Error creating backup directory", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path, err := createBackup(dir, time.Now())
+	if err != nil {
+		requestLogger(r).Error("Error backing up the database", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	snapshot, err := os.Open(path)
+	if err != nil {
+		requestLogger(r).Error("Error opening backup", "path", path, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer snapshot.Close()
+
+	recordWebAudit(r, "backup download", "", filepath.Base(path))
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filepath.Base(path)+`"`)
+	w.Header().Set("Cache-Control", "no-store")
+	io.Copy(w, snapshot)
+}
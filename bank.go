@@ -0,0 +1,323 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type BankQuestion struct {
+	QuestionId    int64
+	QuestionText  string
+	Answers       []string
+	CorrectAnswer int64
+	Category      string
+	Difficulty    string
+	Author        string
+	Tags          []string
+	Quizzes       []string
+	// the organisation whose bank the question is in, empty for the default organisation
+	OrgId string
+}
+
+type BankFilter struct {
+	OrgId      string
+	Text       string
+	Tag        string
+	Category   string
+	Difficulty string
+	Author     string
+}
+
+var difficulties = []string{"easy", "medium", "hard"}
+
+func validateDifficulty(difficulty string) error {
+	if difficulty == "" {
+		return nil
+	}
+	for _, allowed := range difficulties {
+		if difficulty == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("difficulty must be one of %s, got %q", strings.Join(difficulties, ", "), difficulty)
+}
+
+// tags are entered comma separated and stored lower case without duplicates
+func parseTags(tagList string) []string {
+	seen := map[string]bool{}
+	var tags []string
+	for _, tag := range strings.Split(tagList, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+func setQuestionTags(questionId int64, tags []string) error {
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM question_tags WHERE question_id = ?", questionId); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, tag := range tags {
+		if _, err := tx.Exec("INSERT INTO question_tags(question_id, tag) VALUES (?, ?)", questionId, tag); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// links a bank question into a quiz at the given position, re-adding an existing question just moves it
+func addQuestionToQuiz(quizId string, questionId int64, sortOrder string) error {
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// only questions from the quiz's own organisation's bank
+	var exists int
+	err = db.QueryRow("SELECT COUNT(*) FROM questions WHERE question_id = ? AND org_id = ?", questionId, quizOrganisation(quizId)).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists == 0 {
+		return fmt.Errorf("no question found with ID %d", questionId)
+	}
+
+	_, err = db.Exec(`INSERT INTO quiz_questions(quiz_id, question_id, sort_order, active) VALUES (?, ?, ?, 1)
+		ON CONFLICT(quiz_id, question_id) DO UPDATE SET sort_order = excluded.sort_order, active = 1`, quizId, questionId, sortOrder)
+	return err
+}
+
+func removeQuestionFromQuiz(quizId string, questionId int64) error {
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	result, err := db.Exec("DELETE FROM quiz_questions WHERE quiz_id = ? AND question_id = ?", quizId, questionId)
+	if err != nil {
+		return err
+	}
+	if removed, _ := result.RowsAffected(); removed == 0 {
+		return fmt.Errorf("question %d is not part of %s", questionId, quizId)
+	}
+
+	return nil
+}
+
+// changes the position, active flag, round or points of a question within one quiz, a round of 0 takes it out of its round
+func updateQuizQuestion(quizId string, questionId int64, changes map[string]interface{}) error {
+	if roundId, found := changes["round_id"]; found {
+		if roundId == int64(0) {
+			changes["round_id"] = nil
+		} else if exists, err := roundInQuiz(quizId, roundId); err != nil {
+			return err
+		} else if !exists {
+			return fmt.Errorf("round %v is not part of %s", roundId, quizId)
+		}
+	}
+
+	var setClauses []string
+	var args []interface{}
+	for _, column := range []string{"active", "points", "round_id", "sort_order"} {
+		if value, found := changes[column]; found {
+			setClauses = append(setClauses, column+" = ?")
+			args = append(args, value)
+		}
+	}
+	if len(setClauses) == 0 {
+		return nil
+	}
+	args = append(args, quizId, questionId)
+
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	result, err := db.Exec("UPDATE quiz_questions SET "+strings.Join(setClauses, ", ")+" WHERE quiz_id = ? AND question_id = ?", args...)
+	if err != nil {
+		return err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return fmt.Errorf("question %d is not part of %s", questionId, quizId)
+	}
+
+	return nil
+}
+
+func searchQuestionBank(filter BankFilter) ([]BankQuestion, error) {
+	searchQuery := `SELECT questions.question_id, questions.question, answer_1, answer_2, answer_3, answer_4, correct_answer,
+		category, difficulty, author,
+		(SELECT GROUP_CONCAT(tag) FROM (SELECT tag FROM question_tags WHERE question_tags.question_id = questions.question_id ORDER BY tag)) AS tags,
+		(SELECT GROUP_CONCAT(quiz_id) FROM (SELECT quiz_id FROM quiz_questions WHERE quiz_questions.question_id = questions.question_id ORDER BY quiz_id)) AS quizzes
+		FROM questions
+		WHERE org_id = ?`
+	args := []interface{}{filter.OrgId}
+	if filter.OrgId == "" {
+		args[0] = defaultOrganisation
+	}
+
+	if filter.Text != "" {
+		searchQuery += " AND (question LIKE ? OR answer_1 LIKE ? OR answer_2 LIKE ? OR answer_3 LIKE ? OR answer_4 LIKE ?)"
+		pattern := "%" + filter.Text + "%"
+		args = append(args, pattern, pattern, pattern, pattern, pattern)
+	}
+	if filter.Tag != "" {
+		searchQuery += " AND EXISTS (SELECT 1 FROM question_tags WHERE question_tags.question_id = questions.question_id AND tag = ?)"
+		args = append(args, strings.ToLower(strings.TrimSpace(filter.Tag)))
+	}
+	if filter.Category != "" {
+		searchQuery += " AND category = ? COLLATE NOCASE"
+		args = append(args, filter.Category)
+	}
+	if filter.Difficulty != "" {
+		searchQuery += " AND difficulty = ?"
+		args = append(args, filter.Difficulty)
+	}
+	if filter.Author != "" {
+		searchQuery += " AND author = ? COLLATE NOCASE"
+		args = append(args, filter.Author)
+	}
+	searchQuery += " ORDER BY questions.question_id DESC"
+
+	rows, err := makeDatabaseQuery(searchQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var questions []BankQuestion
+	for _, row := range rows {
+		question := BankQuestion{
+			QuestionId:    row["question_id"].(int64),
+			QuestionText:  row["question"].(string),
+			CorrectAnswer: row["correct_answer"].(int64),
+			Category:      row["category"].(string),
+			Difficulty:    row["difficulty"].(string),
+			Author:        row["author"].(string),
+		}
+		for number := 1; number <= 4; number++ {
+			answer, _ := row[fmt.Sprintf("answer_%d", number)].(string)
+			question.Answers = append(question.Answers, answer)
+		}
+		if tags, ok := row["tags"].(string); ok {
+			question.Tags = strings.Split(tags, ",")
+		}
+		if quizzes, ok := row["quizzes"].(string); ok {
+			for _, quizId := range strings.Split(quizzes, ",") {
+				question.Quizzes = append(question.Quizzes, publicQuizId(quizId))
+			}
+		}
+		questions = append(questions, question)
+	}
+
+	return questions, nil
+}
+
+func listCategories(orgId string) ([]string, error) {
+	rows, err := makeDatabaseQuery("SELECT DISTINCT category FROM questions WHERE org_id = ? AND category != '' ORDER BY category", orgId)
+	if err != nil {
+		return nil, err
+	}
+
+	var categories []string
+	for _, row := range rows {
+		categories = append(categories, row["category"].(string))
+	}
+	return categories, nil
+}
+
+// handles /question-bank/, GET searches the bank and POST adds a question from the bank to a quiz
+func questionBank(w http.ResponseWriter, r *http.Request) {
+	org := requestOrganisation(r)
+
+	if r.Method == "POST" {
+		quizId := r.PostFormValue("quiz_id")
+		sortOrder := r.PostFormValue("sort_order")
+		questionId, err := strconv.ParseInt(r.PostFormValue("question_id"), 10, 64)
+
+		responseText := `<p class="green">Added to {{ . }}</p>`
+		if err != nil || quizId == "" || sortOrder == "" {
+			responseText = `<p class="error">Quiz ID and question number are required</p>`
+		} else if exists, err := quizExists(scopedQuizId(org.OrgId, quizId)); err != nil || !exists {
+			responseText = `<p class="error">No quiz found with ID {{ . }}</p>`
+		} else if err := addQuestionToQuiz(scopedQuizId(org.OrgId, quizId), questionId, sortOrder); err != nil {
+			requestLogger(r).Error("Error adding question to quiz", "quiz_id", quizId, "error", err)
+			responseText = `<p class="error">There was a problem adding the question</p>`
+		} else {
+			recordWebAudit(r, "quiz add-question", scopedQuizId(org.OrgId, quizId), fmt.Sprintf("question %d at %s", questionId, sortOrder))
+		}
+
+		tmpl, err := template.New("response").Parse(responseText)
+		if err != nil {
+			requestLogger(r).Error("Error rendering template", "error", err)
+			return
+		}
+		tmpl.Execute(w, quizId)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := BankFilter{
+		OrgId:      org.OrgId,
+		Text:       query.Get("text"),
+		Tag:        query.Get("tag"),
+		Category:   query.Get("category"),
+		Difficulty: query.Get("difficulty"),
+		Author:     query.Get("author"),
+	}
+
+	questions, err := searchQuestionBank(filter)
+	if err != nil {
+		requestLogger(r).Error("Error searching question bank", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	categories, err := listCategories(org.OrgId)
+	if err != nil {
+		requestLogger(r).Error("Error listing categories", "error", err)
+	}
+
+	tmpl, err := pageTemplates.get("question-bank")
+	if err != nil {
+		requestLogger(r).Error("Error rendering template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+		"Filter":       filter,
+		"Questions":    questions,
+		"Categories":   categories,
+		"Difficulties": difficulties,
+		"OrgPath":      org.BasePath,
+	})
+	if err != nil {
+		requestLogger(r).Error("Error rendering template", "error", err)
+	}
+}
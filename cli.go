@@ -0,0 +1,1454 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// set with the global -org flag, quiz IDs given to commands are looked up within it
+var commandOrganisation = defaultOrganisation
+
+type Subcommand struct {
+	Usage string
+	Run   func(args []string) error
+	// commands that change things are recorded in the audit trail
+	Audit bool
+}
+
+// top level commands, commands with their own subcommands (e.g. "quiz list") are grouped under the first word
+var commands = map[string]map[string]Subcommand{
+	"serve": {
+		"": {Usage: "serve [-port 8001] [-dev] [-log-format text|json] [-log-level debug|info|warn|error] [-backup-dir <directory>] [-backup-interval 6h] [-backup-keep 28] [-registrations-per-minute 60] [-requests-per-minute 600] [-contestant-requests-per-minute 60] [-client-ip-header <header>]", Run: serveCommand},
+	},
+	"migrate": {
+		"": {Usage: "migrate [-status]", Run: migrateCommand},
+	},
+	"quiz": {
+		"list":            {Usage: "quiz list", Run: quizListCommand},
+		"create":          {Usage: "quiz create -id <quiz id> -name <name>", Run: quizCreateCommand, Audit: true},
+		"update":          {Usage: "quiz update -id <quiz id> [-name <name>] [-shuffle-questions true|false] [-shuffle-answers true|false] [-sample-size <n>] [-sample-stratify tag|difficulty] [-negative-marking <points>] [-speed-bonus <points> -speed-bonus-seconds <n>] [-streak-bonus <points>] [-tie-breaker time|last_answer|estimate] [-estimate-question <text> -estimate-answer <n>] [-jokers true|false] [-fifty-fifty true|false] [-locale <locale>] [-integrity-checks true|false] [-max-group-size <n>] [-proof-of-work true|false]", Run: quizUpdateCommand, Audit: true},
+		"delete":          {Usage: "quiz delete -id <quiz id> -yes", Run: quizDeleteCommand, Audit: true},
+		"schedule":        {Usage: "quiz schedule -id <quiz id> [-group <group>] [-opens-at <time>] [-closes-at <time>]", Run: quizScheduleCommand, Audit: true},
+		"theme":           {Usage: "quiz theme -id <quiz id> [-preset <preset>] [-background|-panel|-text|-accent|-accent-dark|-error <#hex>] [-font <font>] [-logo-url <url>] [-background-image-url <url>] [-correct <message>]... [-incorrect <message>]...", Run: quizThemeCommand, Audit: true},
+		"add-question":    {Usage: "quiz add-question -quiz <quiz id> -question <question id> -sort-order <n> [-round <round id>] [-points <n>]", Run: quizAddQuestionCommand, Audit: true},
+		"remove-question": {Usage: "quiz remove-question -quiz <quiz id> -question <question id>", Run: quizRemoveQuestionCommand, Audit: true},
+	},
+	"question": {
+		"add":       {Usage: "question add [-quiz <quiz id> -sort-order <n>] -question <text> -answer-1 .. -answer-4 <text> -correct-answer <1-4> [-category <c>] [-difficulty easy|medium|hard] [-author <a>] [-tags a,b]", Run: questionAddCommand, Audit: true},
+		"edit":      {Usage: "question edit -id <question id> [-question <text>] [-answer-1 .. -answer-4 <text>] [-correct-answer <1-4>] [-category <c>] [-difficulty <d>] [-author <a>] [-tags a,b] [-quiz <quiz id> [-sort-order <n>] [-active true|false] [-round <round id>] [-points <n>]]", Run: questionEditCommand, Audit: true},
+		"search":    {Usage: "question search [-text <text>] [-tag <tag>] [-category <c>] [-difficulty <d>] [-author <a>]", Run: questionSearchCommand},
+		"translate": {Usage: "question translate -id <question id> -locale <locale> (-question <text> [-answer-1 .. -answer-4 <text>] | -remove)", Run: questionTranslateCommand, Audit: true},
+	},
+	"round": {
+		"list":   {Usage: "round list -quiz <quiz id>", Run: roundListCommand},
+		"add":    {Usage: "round add -quiz <quiz id> -title <title> -sort-order <n> [-intro <text>] [-time-limit <seconds>] [-multiplier <x>]", Run: roundAddCommand, Audit: true},
+		"update": {Usage: "round update -id <round id> [-title <title>] [-intro <text>] [-sort-order <n>] [-time-limit <seconds>] [-multiplier <x>]", Run: roundUpdateCommand, Audit: true},
+		"delete": {Usage: "round delete -id <round id>", Run: roundDeleteCommand, Audit: true},
+	},
+	"group": {
+		"reset": {Usage: "group reset -quiz <quiz id> -group <group> -yes", Run: groupResetCommand, Audit: true},
+	},
+	"scores": {
+		"export": {Usage: "scores export -quiz <quiz id> [-group <group>] [-format csv|json|answers|pdf] [-out <file>]", Run: scoresExportCommand},
+	},
+	"org": {
+		"list":   {Usage: "org list", Run: orgListCommand},
+		"create": {Usage: "org create -id <org id> -name <name> [-host <host name>]", Run: orgCreateCommand, Audit: true},
+		"update": {Usage: "org update -id <org id> [-name <name>] [-host <host name>] [-rotate-key]", Run: orgUpdateCommand, Audit: true},
+	},
+	"admin": {
+		"add":    {Usage: "admin add -user <user name>", Run: adminAddCommand, Audit: true},
+		"remove": {Usage: "admin remove -user <user name>", Run: adminRemoveCommand, Audit: true},
+	},
+	"role": {
+		"list":   {Usage: "role list [-user <user name>]", Run: roleListCommand},
+		"grant":  {Usage: "role grant -user <user name> -role owner|author|host|viewer [-quiz <quiz id>]", Run: roleGrantCommand, Audit: true},
+		"revoke": {Usage: "role revoke -user <user name> -role owner|author|host|viewer [-quiz <quiz id>]", Run: roleRevokeCommand, Audit: true},
+	},
+	"audit": {
+		"list": {Usage: "audit list [-quiz <quiz id>] [-limit <n>]", Run: auditListCommand},
+	},
+	"backup": {
+		"create":  {Usage: "backup create [-dir <directory>] [-keep <n>]", Run: backupCreateCommand},
+		"list":    {Usage: "backup list [-dir <directory>]", Run: backupListCommand},
+		"restore": {Usage: "backup restore -file <backup> -yes", Run: backupRestoreCommand, Audit: true},
+	},
+	"contestant": {
+		"remove": {Usage: "contestant remove (-id <contestant id> | -quiz <quiz id> -group <group> -name <name>)", Run: contestantRemoveCommand, Audit: true},
+	},
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: quiz [-db <path>] [-org <org id>] <command> [options]")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Commands:")
+
+	var usages []string
+	for _, subcommands := range commands {
+		for _, subcommand := range subcommands {
+			usages = append(usages, subcommand.Usage)
+		}
+	}
+	sort.Strings(usages)
+	for _, usage := range usages {
+		fmt.Fprintln(w, "  "+usage)
+	}
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Running without a command starts the web server.")
+}
+
+// parses the global flags and dispatches to the matching command
+func runCommand(args []string) error {
+	globalFlags := flag.NewFlagSet("quiz", flag.ContinueOnError)
+	globalFlags.Usage = func() { printUsage(os.Stderr) }
+	dbPath := globalFlags.String("db", "", "path to the SQLite database")
+	orgId := globalFlags.String("org", "", "organisation the quiz and question commands work on")
+	if err := globalFlags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	if envPath := os.Getenv("QUIZ_DATABASE"); envPath != "" {
+		databasePath = envPath
+	}
+	if *dbPath != "" {
+		databasePath = *dbPath
+	}
+	if envOrg := os.Getenv("QUIZ_ORG"); envOrg != "" {
+		commandOrganisation = envOrg
+	}
+	if *orgId != "" {
+		commandOrganisation = *orgId
+	}
+	if err := validateOrgId(commandOrganisation); err != nil {
+		return err
+	}
+
+	args = globalFlags.Args()
+	if len(args) == 0 {
+		return serveCommand(nil)
+	}
+
+	if args[0] == "help" {
+		printUsage(os.Stdout)
+		return nil
+	}
+
+	subcommands, found := commands[args[0]]
+	if !found {
+		printUsage(os.Stderr)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+
+	if subcommand, found := subcommands[""]; found {
+		return subcommand.Run(args[1:])
+	}
+
+	if len(args) < 2 {
+		printUsage(os.Stderr)
+		return fmt.Errorf("%s needs a subcommand", args[0])
+	}
+
+	subcommand, found := subcommands[args[1]]
+	if !found {
+		printUsage(os.Stderr)
+		return fmt.Errorf("unknown command %q", args[0]+" "+args[1])
+	}
+
+	if err := subcommand.Run(args[2:]); err != nil {
+		return err
+	}
+	if subcommand.Audit {
+		err := recordAudit(commandOrganisation, commandUsername(), args[0]+" "+args[1], commandQuizId(args[0], args[2:]), strings.Join(args[2:], " "))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Warning: unable to record the change in the audit trail:", err.Error())
+		}
+	}
+	return nil
+}
+
+// the stored ID for a quiz ID given on the command line
+func orgQuizId(quizId string) string {
+	return scopedQuizId(commandOrganisation, quizId)
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	return flag.NewFlagSet(name, flag.ContinueOnError)
+}
+
+func requireFlags(values map[string]string) error {
+	var missing []string
+	for name, value := range values {
+		if value == "" {
+			missing = append(missing, "-"+name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("missing required flags: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func serveCommand(args []string) error {
+	flags := newFlagSet("serve")
+	port := flags.String("port", "8001", "port to listen on")
+	dev := flags.Bool("dev", false, "read templates from ./templates and reload them when they change")
+	logFormat := flags.String("log-format", "text", "text or json")
+	logLevel := flags.String("log-level", "info", "debug logs every database query")
+	backupDir := flags.String("backup-dir", "", "where scheduled backups go, a backups directory next to the database by default")
+	backupInterval := flags.Duration("backup-interval", 6*time.Hour, "how often to back up the database, 0 turns scheduled backups off")
+	backupKeep := flags.Int("backup-keep", 28, "number of scheduled backups to keep")
+	flags.IntVar(&rateLimits.RegistrationsPerMinute, "registrations-per-minute", rateLimits.RegistrationsPerMinute, "registrations allowed from one IP address, 0 for no limit")
+	flags.IntVar(&rateLimits.RequestsPerMinute, "requests-per-minute", rateLimits.RequestsPerMinute, "answers and other quiz requests allowed from one IP address, 0 for no limit")
+	flags.IntVar(&rateLimits.ContestantRequestsPerMinute, "contestant-requests-per-minute", rateLimits.ContestantRequestsPerMinute, "answers and other quiz requests allowed from one contestant, 0 for no limit")
+	flags.StringVar(&clientIpHeader, "client-ip-header", os.Getenv("QUIZ_CLIENT_IP_HEADER"), "header holding the client's address when behind a proxy, e.g. Fly-Client-IP")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := setupLogging(*logFormat, *logLevel); err != nil {
+		return err
+	}
+	if *backupKeep < 1 {
+		return errors.New("-backup-keep must be at least 1")
+	}
+
+	if _, err := migrateDatabase(); err != nil {
+		return err
+	}
+
+	if *backupInterval > 0 {
+		if *backupDir == "" {
+			*backupDir = defaultBackupDir()
+		}
+		go runScheduledBackups(*backupDir, *backupInterval, *backupKeep)
+	}
+
+	return serve(*port, *dev)
+}
+
+func migrateCommand(args []string) error {
+	flags := newFlagSet("migrate")
+	status := flags.Bool("status", false, "only show the current and latest schema versions")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *status {
+		version, err := currentSchemaVersion()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Schema version %d, latest is %d\n", version, latestSchemaVersion())
+		return nil
+	}
+
+	applied, err := migrateDatabase()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Applied %d migration(s), schema is at version %d\n", applied, latestSchemaVersion())
+	return nil
+}
+
+func quizListCommand(args []string) error {
+	flags := newFlagSet("quiz list")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	quizzes, err := listQuizzes(commandOrganisation)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "QUIZ ID\tNAME\tQUESTIONS\tCONTESTANTS")
+	for _, quiz := range quizzes {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", publicQuizId(quiz.QuizId), quiz.Name, quiz.ActiveQuestions, quiz.Contestants)
+	}
+	return w.Flush()
+}
+
+func quizCreateCommand(args []string) error {
+	flags := newFlagSet("quiz create")
+	quizId := flags.String("id", "", "quiz ID used in URLs")
+	quizName := flags.String("name", "", "display name")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(map[string]string{"id": *quizId, "name": *quizName}); err != nil {
+		return err
+	}
+	if err := validateQuizId(*quizId); err != nil {
+		return err
+	}
+
+	quizDetails, success := createQuiz(orgQuizId(*quizId), *quizName)
+	if !success {
+		return fmt.Errorf("unable to create quiz %s", *quizId)
+	}
+	if quizDetails.Name != *quizName {
+		fmt.Printf("Quiz %s already exists as %q\n", *quizId, quizDetails.Name)
+		return nil
+	}
+
+	fmt.Printf("Quiz %s ready\n", *quizId)
+	return nil
+}
+
+func quizUpdateCommand(args []string) error {
+	flags := newFlagSet("quiz update")
+	quizId := flags.String("id", "", "quiz ID to update")
+	for column, isFlag := range quizSettings {
+		name := strings.ReplaceAll(column, "_", "-")
+		if isFlag {
+			flags.String(name, "", "true or false")
+		} else {
+			flags.String(name, "", "new value")
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(map[string]string{"id": *quizId}); err != nil {
+		return err
+	}
+
+	// only change the settings for flags that were actually passed
+	changes := map[string]interface{}{}
+	var visitErr error
+	flags.Visit(func(f *flag.Flag) {
+		column := strings.ReplaceAll(f.Name, "-", "_")
+		isFlag, found := quizSettings[column]
+		if !found {
+			return
+		}
+		value := f.Value.String()
+		if !isFlag {
+			if err := validateQuizSetting(column, value); err != nil {
+				visitErr = err
+			}
+			changes[column] = value
+			return
+		}
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			visitErr = fmt.Errorf("invalid -%s value %q", f.Name, value)
+		}
+		if enabled {
+			changes[column] = 1
+		} else {
+			changes[column] = 0
+		}
+	})
+	if visitErr != nil {
+		return visitErr
+	}
+	if len(changes) == 0 {
+		return errors.New("nothing to change, pass at least one setting to update")
+	}
+
+	if err := updateQuiz(orgQuizId(*quizId), changes); err != nil {
+		return err
+	}
+
+	fmt.Printf("Updated quiz %s\n", *quizId)
+	return nil
+}
+
+// a flag that can be passed more than once, e.g. -correct "Well done" -correct "Nice one"
+type stringList []string
+
+func (list *stringList) String() string {
+	return strings.Join(*list, ", ")
+}
+
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+func quizThemeCommand(args []string) error {
+	flags := newFlagSet("quiz theme")
+	quizId := flags.String("id", "", "quiz ID")
+	flags.String("preset", "", "one of "+strings.Join(themePresetNames(), ", "))
+	for _, colour := range themeColours {
+		flags.String(colour.Name, "", colour.Name+" colour as #hex, empty to use the preset's")
+	}
+	flags.String("font", "", "one of "+strings.Join(themeFontNames(), ", ")+", empty to use the preset's")
+	flags.String("logo-url", "", "https:// URL or path of the logo, empty to remove it")
+	flags.String("background-image-url", "", "https:// URL or path of the background image, empty to remove it")
+	var correct, incorrect stringList
+	flags.Var(&correct, "correct", "message for a correct answer, repeat for more, replaces the existing ones. Pass \"\" to use the preset's")
+	flags.Var(&incorrect, "incorrect", "message for an incorrect answer, repeat for more, replaces the existing ones. Pass \"\" to use the preset's")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(map[string]string{"id": *quizId}); err != nil {
+		return err
+	}
+	storedId := orgQuizId(*quizId)
+	exists, err := quizExists(storedId)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("no quiz found with ID %s", *quizId)
+	}
+
+	theme, err := getTheme(storedId)
+	if err != nil {
+		return err
+	}
+
+	// only change the settings for flags that were actually passed
+	themeChanged := false
+	flags.Visit(func(f *flag.Flag) {
+		value := strings.TrimSpace(f.Value.String())
+		switch f.Name {
+		case "id", "correct", "incorrect":
+			return
+		case "preset":
+			theme.Preset = value
+		case "font":
+			theme.Font = value
+		case "logo-url":
+			theme.LogoUrl = value
+		case "background-image-url":
+			theme.BackgroundImageUrl = value
+		default:
+			theme.Colours[f.Name] = value
+		}
+		themeChanged = true
+	})
+
+	if themeChanged {
+		if err := saveTheme(storedId, theme); err != nil {
+			return err
+		}
+	}
+	if len(correct) > 0 {
+		if err := setFeedbackMessages(storedId, feedbackCorrect, correct); err != nil {
+			return err
+		}
+	}
+	if len(incorrect) > 0 {
+		if err := setFeedbackMessages(storedId, feedbackIncorrect, incorrect); err != nil {
+			return err
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Preset:\t%s\n", theme.Preset)
+	for _, colour := range themeColours {
+		source := ""
+		if theme.Colours[colour.Name] == "" {
+			source = " (preset)"
+		}
+		fmt.Fprintf(w, "%s:\t%s%s\n", colour.Name, theme.colour(colour.Name), source)
+	}
+	font := theme.Font
+	if font == "" {
+		font = themePresets[theme.Preset].Font + " (preset)"
+	}
+	fmt.Fprintf(w, "Font:\t%s\n", font)
+	fmt.Fprintf(w, "Logo:\t%s\n", theme.LogoUrl)
+	fmt.Fprintf(w, "Background image:\t%s\n", theme.BackgroundImageUrl)
+	for _, kind := range []string{feedbackCorrect, feedbackIncorrect} {
+		messages, err := feedbackMessages(storedId, kind, theme)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "Messages for %s answers:\t%s\n", kind, strings.Join(messages, " | "))
+	}
+	return w.Flush()
+}
+
+func quizDeleteCommand(args []string) error {
+	flags := newFlagSet("quiz delete")
+	quizId := flags.String("id", "", "quiz ID to delete")
+	confirmed := flags.Bool("yes", false, "confirm deleting the quiz, its questions and all scores")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(map[string]string{"id": *quizId}); err != nil {
+		return err
+	}
+	if !*confirmed {
+		return errors.New("this deletes the quiz, its questions and all scores, re-run with -yes to confirm")
+	}
+
+	if err := deleteQuiz(orgQuizId(*quizId)); err != nil {
+		return err
+	}
+
+	fmt.Printf("Deleted quiz %s\n", *quizId)
+	return nil
+}
+
+func quizScheduleCommand(args []string) error {
+	flags := newFlagSet("quiz schedule")
+	quizId := flags.String("id", "", "quiz ID")
+	group := flags.String("group", "", "only change the times for this group")
+	flags.String("opens-at", "", "when the quiz opens, YYYY-MM-DD HH:MM in local time or RFC 3339, empty to clear")
+	flags.String("closes-at", "", "when the quiz closes, YYYY-MM-DD HH:MM in local time or RFC 3339, empty to clear")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(map[string]string{"id": *quizId}); err != nil {
+		return err
+	}
+
+	// only change the times for flags that were actually passed
+	changes := map[string]interface{}{}
+	var visitErr error
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name != "opens-at" && f.Name != "closes-at" {
+			return
+		}
+		value, err := parseScheduleTime(f.Value.String())
+		if err != nil {
+			visitErr = err
+		}
+		changes[strings.ReplaceAll(f.Name, "-", "_")] = value
+	})
+	if visitErr != nil {
+		return visitErr
+	}
+
+	if len(changes) > 0 {
+		if err := setSchedule(orgQuizId(*quizId), *group, changes); err != nil {
+			return err
+		}
+	}
+
+	schedule, err := getSchedule(orgQuizId(*quizId), *group)
+	if err != nil {
+		return err
+	}
+	describe := func(at time.Time) string {
+		if at.IsZero() {
+			return "not set"
+		}
+		return at.Local().Format("2006-01-02 15:04 MST")
+	}
+	fmt.Printf("Opens: %s\nCloses: %s\n", describe(schedule.OpensAt), describe(schedule.ClosesAt))
+	return nil
+}
+
+func questionAddCommand(args []string) error {
+	flags := newFlagSet("question add")
+	quizId := flags.String("quiz", "", "quiz ID to add the question to, leave out to only add it to the bank")
+	sortOrder := flags.String("sort-order", "", "question number within the quiz")
+	question := flags.String("question", "", "question text")
+	answers := make([]*string, 4)
+	for i := range answers {
+		answers[i] = flags.String(fmt.Sprintf("answer-%d", i+1), "", fmt.Sprintf("answer %d text", i+1))
+	}
+	correctAnswer := flags.String("correct-answer", "", "number of the correct answer (1-4)")
+	category := flags.String("category", "", "category, e.g. Music")
+	difficulty := flags.String("difficulty", "", "easy, medium or hard")
+	author := flags.String("author", "", "who wrote the question")
+	tags := flags.String("tags", "", "comma separated tags")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	required := map[string]string{"question": *question, "correct-answer": *correctAnswer}
+	if *quizId != "" {
+		required["sort-order"] = *sortOrder
+	}
+	if err := requireFlags(required); err != nil {
+		return err
+	}
+	if err := validateCorrectAnswer(*correctAnswer, []string{*answers[0], *answers[1], *answers[2], *answers[3]}); err != nil {
+		return err
+	}
+	if err := validateDifficulty(*difficulty); err != nil {
+		return err
+	}
+
+	if *quizId != "" {
+		exists, err := quizExists(orgQuizId(*quizId))
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("quiz %s does not exist, create it first with quiz create", *quizId)
+		}
+	}
+
+	correctAnswerInt, _ := strconv.ParseInt(*correctAnswer, 10, 64)
+	questionId, err := insertQuestion(BankQuestion{
+		QuestionText:  *question,
+		Answers:       []string{*answers[0], *answers[1], *answers[2], *answers[3]},
+		CorrectAnswer: correctAnswerInt,
+		Category:      *category,
+		Difficulty:    *difficulty,
+		Author:        *author,
+		Tags:          parseTags(*tags),
+		OrgId:         commandOrganisation,
+	})
+	if err != nil {
+		return err
+	}
+
+	if *quizId == "" {
+		fmt.Printf("Added question %d to the bank\n", questionId)
+		return nil
+	}
+
+	if err := addQuestionToQuiz(orgQuizId(*quizId), questionId, *sortOrder); err != nil {
+		return err
+	}
+
+	fmt.Printf("Added question %d to %s\n", questionId, *quizId)
+	return nil
+}
+
+func questionTranslateCommand(args []string) error {
+	flags := newFlagSet("question translate")
+	questionId := flags.Int64("id", 0, "question ID to translate")
+	locale := flags.String("locale", "", "one of "+strings.Join(supportedLocales(), ", "))
+	question := flags.String("question", "", "question text in that locale")
+	var answers [4]string
+	for i := range answers {
+		flags.StringVar(&answers[i], fmt.Sprintf("answer-%d", i+1), "", fmt.Sprintf("answer %d text in that locale, leave out to show it untranslated", i+1))
+	}
+	remove := flags.Bool("remove", false, "remove the translation")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *questionId == 0 {
+		return errors.New("missing required flags: -id")
+	}
+	if err := requireFlags(map[string]string{"locale": *locale}); err != nil {
+		return err
+	}
+	if inOrg, err := questionInOrganisation(commandOrganisation, *questionId); err != nil || !inOrg {
+		return fmt.Errorf("no question found with ID %d", *questionId)
+	}
+
+	if *remove {
+		if err := removeQuestionTranslation(*questionId, *locale); err != nil {
+			return err
+		}
+		fmt.Printf("Removed the %s translation of question %d\n", *locale, *questionId)
+		return nil
+	}
+	if err := requireFlags(map[string]string{"question": *question}); err != nil {
+		return err
+	}
+	if err := setQuestionTranslation(*questionId, *locale, *question, answers); err != nil {
+		return err
+	}
+	fmt.Printf("Saved the %s translation of question %d\n", *locale, *questionId)
+	return nil
+}
+
+func questionEditCommand(args []string) error {
+	flags := newFlagSet("question edit")
+	questionId := flags.Int64("id", 0, "question ID to edit")
+	quizId := flags.String("quiz", "", "quiz ID, needed to change -sort-order or -active")
+	flags.String("sort-order", "", "question number within the quiz")
+	flags.String("active", "", "whether the question is shown in the quiz (true/false)")
+	flags.String("round", "", "round ID within the quiz, 0 takes it out of its round")
+	flags.String("points", "", "points the question is worth in the quiz")
+	flags.String("question", "", "question text")
+	for i := 1; i <= 4; i++ {
+		flags.String(fmt.Sprintf("answer-%d", i), "", fmt.Sprintf("answer %d text", i))
+	}
+	flags.String("correct-answer", "", "number of the correct answer (1-4)")
+	flags.String("category", "", "category")
+	flags.String("difficulty", "", "easy, medium or hard")
+	flags.String("author", "", "who wrote the question")
+	tags := flags.String("tags", "", "comma separated tags, replaces the existing tags")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *questionId == 0 {
+		return errors.New("missing required flags: -id")
+	}
+	if inOrg, err := questionInOrganisation(commandOrganisation, *questionId); err != nil || !inOrg {
+		return fmt.Errorf("no question found with ID %d", *questionId)
+	}
+
+	// only update the columns for flags that were actually passed, position and active are per quiz
+	columns := map[string]string{
+		"question":       "question",
+		"answer-1":       "answer_1",
+		"answer-2":       "answer_2",
+		"answer-3":       "answer_3",
+		"answer-4":       "answer_4",
+		"correct-answer": "correct_answer",
+		"category":       "category",
+		"difficulty":     "difficulty",
+		"author":         "author",
+		"sort-order":     "sort_order",
+		"active":         "active",
+		"round":          "round_id",
+		"points":         "points",
+	}
+	changes := map[string]interface{}{}
+	quizChanges := map[string]interface{}{}
+	tagsChanged := false
+	var visitErr error
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "tags" {
+			tagsChanged = true
+			return
+		}
+		column, found := columns[f.Name]
+		if !found {
+			return
+		}
+		value := f.Value.String()
+		switch f.Name {
+		case "difficulty":
+			if err := validateDifficulty(value); err != nil {
+				visitErr = err
+			}
+		case "sort-order":
+			quizChanges[column] = value
+			return
+		case "round":
+			roundId, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				visitErr = fmt.Errorf("invalid -round value %q", value)
+			}
+			quizChanges[column] = roundId
+			return
+		case "points":
+			points, err := strconv.ParseFloat(value, 64)
+			if err != nil || points < 0 {
+				visitErr = fmt.Errorf("invalid -points value %q", value)
+			}
+			quizChanges[column] = points
+			return
+		case "active":
+			active, err := strconv.ParseBool(value)
+			if err != nil {
+				visitErr = fmt.Errorf("invalid -active value %q", value)
+			}
+			if active {
+				quizChanges[column] = 1
+			} else {
+				quizChanges[column] = 0
+			}
+			return
+		}
+		changes[column] = value
+	})
+	if visitErr != nil {
+		return visitErr
+	}
+	if len(changes) == 0 && len(quizChanges) == 0 && !tagsChanged {
+		return errors.New("nothing to change, pass at least one field to update")
+	}
+	if len(quizChanges) > 0 && *quizId == "" {
+		return errors.New("-sort-order, -active, -round and -points apply to a single quiz, pass -quiz as well")
+	}
+	if err := validateEditedAnswers(*questionId, changes); err != nil {
+		return err
+	}
+
+	if len(changes) > 0 {
+		if err := updateQuestion(*questionId, changes); err != nil {
+			return err
+		}
+	}
+	if tagsChanged {
+		if err := setQuestionTags(*questionId, parseTags(*tags)); err != nil {
+			return err
+		}
+	}
+	if len(quizChanges) > 0 {
+		if err := updateQuizQuestion(orgQuizId(*quizId), *questionId, quizChanges); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Updated question %d\n", *questionId)
+	return nil
+}
+
+func questionSearchCommand(args []string) error {
+	flags := newFlagSet("question search")
+	var filter BankFilter
+	flags.StringVar(&filter.Text, "text", "", "text in the question or answers")
+	flags.StringVar(&filter.Tag, "tag", "", "tag")
+	flags.StringVar(&filter.Category, "category", "", "category")
+	flags.StringVar(&filter.Difficulty, "difficulty", "", "easy, medium or hard")
+	flags.StringVar(&filter.Author, "author", "", "author")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	filter.OrgId = commandOrganisation
+
+	questions, err := searchQuestionBank(filter)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tQUESTION\tCATEGORY\tDIFFICULTY\tAUTHOR\tTAGS\tQUIZZES")
+	for _, question := range questions {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", question.QuestionId, question.QuestionText, question.Category, question.Difficulty,
+			question.Author, strings.Join(question.Tags, ","), strings.Join(question.Quizzes, ","))
+	}
+	return w.Flush()
+}
+
+func quizAddQuestionCommand(args []string) error {
+	flags := newFlagSet("quiz add-question")
+	quizId := flags.String("quiz", "", "quiz ID")
+	questionId := flags.Int64("question", 0, "bank question ID")
+	sortOrder := flags.String("sort-order", "", "question number within the quiz")
+	roundId := flags.Int64("round", 0, "round ID within the quiz")
+	points := flags.Float64("points", 1, "points the question is worth in the quiz")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(map[string]string{"quiz": *quizId, "sort-order": *sortOrder}); err != nil {
+		return err
+	}
+	if *questionId == 0 {
+		return errors.New("missing required flags: -question")
+	}
+	if *points < 0 {
+		return errors.New("-points can't be negative")
+	}
+
+	exists, err := quizExists(orgQuizId(*quizId))
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("quiz %s does not exist, create it first with quiz create", *quizId)
+	}
+
+	if err := addQuestionToQuiz(orgQuizId(*quizId), *questionId, *sortOrder); err != nil {
+		return err
+	}
+	if err := updateQuizQuestion(orgQuizId(*quizId), *questionId, map[string]interface{}{"round_id": *roundId, "points": *points}); err != nil {
+		return err
+	}
+
+	fmt.Printf("Question %d is number %s in %s\n", *questionId, *sortOrder, *quizId)
+	return nil
+}
+
+func quizRemoveQuestionCommand(args []string) error {
+	flags := newFlagSet("quiz remove-question")
+	quizId := flags.String("quiz", "", "quiz ID")
+	questionId := flags.Int64("question", 0, "bank question ID")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(map[string]string{"quiz": *quizId}); err != nil {
+		return err
+	}
+	if *questionId == 0 {
+		return errors.New("missing required flags: -question")
+	}
+	if inOrg, err := questionInOrganisation(commandOrganisation, *questionId); err != nil || !inOrg {
+		return fmt.Errorf("no question found with ID %d", *questionId)
+	}
+
+	if err := removeQuestionFromQuiz(orgQuizId(*quizId), *questionId); err != nil {
+		return err
+	}
+
+	fmt.Printf("Removed question %d from %s, it is still in the bank\n", *questionId, *quizId)
+	return nil
+}
+
+func roundListCommand(args []string) error {
+	flags := newFlagSet("round list")
+	quizId := flags.String("quiz", "", "quiz ID")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(map[string]string{"quiz": *quizId}); err != nil {
+		return err
+	}
+
+	rounds, err := listRounds(orgQuizId(*quizId))
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tORDER\tTITLE\tTIME LIMIT\tMULTIPLIER")
+	for _, round := range rounds {
+		fmt.Fprintf(w, "%d\t%d\t%s\t%d\t%g\n", round.RoundId, round.SortOrder, round.Title, round.TimeLimit, round.Multiplier)
+	}
+	return w.Flush()
+}
+
+func roundAddCommand(args []string) error {
+	flags := newFlagSet("round add")
+	quizId := flags.String("quiz", "", "quiz ID")
+	title := flags.String("title", "", "round title")
+	intro := flags.String("intro", "", "text shown before the round starts")
+	sortOrder := flags.Int64("sort-order", 0, "round number within the quiz")
+	timeLimit := flags.Int64("time-limit", 0, "seconds allowed for the round, 0 for no limit")
+	multiplier := flags.Float64("multiplier", 1, "points for each correct answer in the round")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(map[string]string{"quiz": *quizId, "title": *title}); err != nil {
+		return err
+	}
+	if *timeLimit < 0 || *multiplier < 0 {
+		return errors.New("-time-limit and -multiplier can't be negative")
+	}
+
+	exists, err := quizExists(orgQuizId(*quizId))
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("quiz %s does not exist, create it first with quiz create", *quizId)
+	}
+
+	roundId, err := addRound(Round{
+		QuizId:     orgQuizId(*quizId),
+		Title:      *title,
+		Intro:      *intro,
+		SortOrder:  *sortOrder,
+		TimeLimit:  *timeLimit,
+		Multiplier: *multiplier,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Added round %d to %s, put questions in it with question edit -quiz %s -round %d\n", roundId, *quizId, *quizId, roundId)
+	return nil
+}
+
+func roundUpdateCommand(args []string) error {
+	flags := newFlagSet("round update")
+	roundId := flags.Int64("id", 0, "round ID to update")
+	for _, name := range roundSettings {
+		flags.String(name, "", "new value")
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *roundId == 0 {
+		return errors.New("missing required flags: -id")
+	}
+
+	// only change the settings for flags that were actually passed
+	changes := map[string]interface{}{}
+	var visitErr error
+	flags.Visit(func(f *flag.Flag) {
+		for column, name := range roundSettings {
+			if f.Name != name {
+				continue
+			}
+			if err := validateRoundSetting(column, f.Value.String()); err != nil {
+				visitErr = err
+			}
+			changes[column] = f.Value.String()
+		}
+	})
+	if visitErr != nil {
+		return visitErr
+	}
+	if len(changes) == 0 {
+		return errors.New("nothing to change, pass at least one setting to update")
+	}
+	if inOrg, err := roundInOrganisation(commandOrganisation, *roundId); err != nil || !inOrg {
+		return fmt.Errorf("no round found with ID %d", *roundId)
+	}
+
+	if err := updateRound(*roundId, changes); err != nil {
+		return err
+	}
+
+	fmt.Printf("Updated round %d\n", *roundId)
+	return nil
+}
+
+func roundDeleteCommand(args []string) error {
+	flags := newFlagSet("round delete")
+	roundId := flags.Int64("id", 0, "round ID to delete")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *roundId == 0 {
+		return errors.New("missing required flags: -id")
+	}
+	if inOrg, err := roundInOrganisation(commandOrganisation, *roundId); err != nil || !inOrg {
+		return fmt.Errorf("no round found with ID %d", *roundId)
+	}
+
+	if err := deleteRound(*roundId); err != nil {
+		return err
+	}
+
+	fmt.Printf("Deleted round %d, its questions are still in the quiz\n", *roundId)
+	return nil
+}
+
+func groupResetCommand(args []string) error {
+	flags := newFlagSet("group reset")
+	quizId := flags.String("quiz", "", "quiz ID")
+	group := flags.String("group", "", "group to reset")
+	confirmed := flags.Bool("yes", false, "confirm removing every contestant in the group")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(map[string]string{"quiz": *quizId, "group": *group}); err != nil {
+		return err
+	}
+	if !*confirmed {
+		return errors.New("this removes every contestant in the group, re-run with -yes to confirm")
+	}
+
+	removed, err := resetGroup(orgQuizId(*quizId), *group)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Removed %d contestant(s) from %s/%s\n", removed, *quizId, strings.ToLower(*group))
+	return nil
+}
+
+func scoresExportCommand(args []string) error {
+	flags := newFlagSet("scores export")
+	quizId := flags.String("quiz", "", "quiz ID")
+	group := flags.String("group", "", "only export this group")
+	format := flags.String("format", "csv", "csv, json, answers (per answer breakdown as CSV) or pdf (winners' certificates)")
+	outPath := flags.String("out", "", "file to write to, defaults to stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(map[string]string{"quiz": *quizId}); err != nil {
+		return err
+	}
+	if _, found := exportFormats[*format]; !found {
+		return fmt.Errorf("unknown export format %q", *format)
+	}
+
+	exists, err := quizExists(orgQuizId(*quizId))
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("no quiz found with ID %s", *quizId)
+	}
+
+	if *outPath == "" {
+		return writeExport(os.Stdout, orgQuizId(*quizId), *group, *format)
+	}
+
+	file, err := os.Create(*outPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return writeExport(file, orgQuizId(*quizId), *group, *format)
+}
+
+func contestantRemoveCommand(args []string) error {
+	flags := newFlagSet("contestant remove")
+	contestantId := flags.String("id", "", "contestant ID")
+	quizId := flags.String("quiz", "", "quiz ID, used with -group and -name")
+	group := flags.String("group", "", "group the contestant is in")
+	name := flags.String("name", "", "contestant name")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *contestantId == "" {
+		if err := requireFlags(map[string]string{"quiz": *quizId, "group": *group, "name": *name}); err != nil {
+			return fmt.Errorf("pass either -id or -quiz, -group and -name: %w", err)
+		}
+		*contestantId = generateContestantId(*name, orgQuizId(*quizId), *group)
+	}
+	if inOrg, err := contestantInOrganisation(commandOrganisation, *contestantId); err != nil || !inOrg {
+		return fmt.Errorf("no contestant found with ID %s", *contestantId)
+	}
+
+	removed, err := removeContestant(*contestantId)
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return fmt.Errorf("no contestant found with ID %s", *contestantId)
+	}
+
+	fmt.Printf("Removed contestant %s\n", *contestantId)
+	return nil
+}
+
+func orgListCommand(args []string) error {
+	flags := newFlagSet("org list")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	orgs, err := listOrganisations()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ORG ID\tNAME\tHOST\tADMIN KEY")
+	for _, org := range orgs {
+		keySet := "not set"
+		if org.adminKeyHash != "" {
+			keySet = "set"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", org.OrgId, org.Name, org.Host, keySet)
+	}
+	return w.Flush()
+}
+
+func orgCreateCommand(args []string) error {
+	flags := newFlagSet("org create")
+	orgId := flags.String("id", "", "organisation ID used in URLs, lower case letters, numbers and dashes")
+	name := flags.String("name", "", "display name")
+	host := flags.String("host", "", "host name the organisation is served on, e.g. finance.quiz.example.com")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(map[string]string{"id": *orgId, "name": *name}); err != nil {
+		return err
+	}
+
+	key, err := createOrganisation(*orgId, *name, *host)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Organisation %s ready at /org/%s/\n", *orgId, *orgId)
+	fmt.Printf("Admin key: %s (log in with user name %s, it won't be shown again)\n", key, *orgId)
+	return nil
+}
+
+func orgUpdateCommand(args []string) error {
+	flags := newFlagSet("org update")
+	orgId := flags.String("id", "", "organisation ID to update")
+	flags.String("name", "", "display name")
+	flags.String("host", "", "host name the organisation is served on, empty to stop using one")
+	rotateKey := flags.Bool("rotate-key", false, "replace the admin key")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(map[string]string{"id": *orgId}); err != nil {
+		return err
+	}
+
+	// only change the values for flags that were actually passed
+	changes := map[string]string{}
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "name" || f.Name == "host" {
+			changes[f.Name] = f.Value.String()
+		}
+	})
+	if len(changes) == 0 && !*rotateKey {
+		return errors.New("nothing to change, pass -name, -host or -rotate-key")
+	}
+
+	if len(changes) > 0 {
+		if err := updateOrganisation(*orgId, changes); err != nil {
+			return err
+		}
+	}
+	if *rotateKey {
+		key, err := rotateAdminKey(*orgId)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Admin key: %s (log in with user name %s, it won't be shown again)\n", key, *orgId)
+	}
+
+	fmt.Printf("Updated organisation %s\n", *orgId)
+	return nil
+}
+
+func adminAddCommand(args []string) error {
+	flags := newFlagSet("admin add")
+	username := flags.String("user", "", "user name to log in with")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(map[string]string{"user": *username}); err != nil {
+		return err
+	}
+
+	key, err := addAdminUser(commandOrganisation, *username)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Added %s, give them a role with role grant\n", *username)
+	fmt.Printf("Admin key: %s (it won't be shown again)\n", key)
+	return nil
+}
+
+func adminRemoveCommand(args []string) error {
+	flags := newFlagSet("admin remove")
+	username := flags.String("user", "", "user name to remove")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(map[string]string{"user": *username}); err != nil {
+		return err
+	}
+
+	if err := removeAdminUser(commandOrganisation, *username); err != nil {
+		return err
+	}
+
+	fmt.Printf("Removed %s\n", *username)
+	return nil
+}
+
+func roleListCommand(args []string) error {
+	flags := newFlagSet("role list")
+	username := flags.String("user", "", "only show roles for this user")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	grants, err := listRoles(commandOrganisation, *username)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "USER\tROLE\tQUIZ")
+	for _, grant := range grants {
+		quiz := publicQuizId(grant.QuizId)
+		if quiz == "" {
+			quiz = "(all)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", grant.Username, grant.Role, quiz)
+	}
+	return w.Flush()
+}
+
+// role grant and role revoke take the same flags
+func parseRoleGrant(name string, args []string) (RoleGrant, error) {
+	var grant RoleGrant
+	flags := newFlagSet(name)
+	flags.StringVar(&grant.Username, "user", "", "user name")
+	flags.StringVar(&grant.Role, "role", "", "owner, author, host or viewer")
+	quizId := flags.String("quiz", "", "only for this quiz, leave out for every quiz in the organisation")
+	if err := flags.Parse(args); err != nil {
+		return grant, err
+	}
+	if err := requireFlags(map[string]string{"user": grant.Username, "role": grant.Role}); err != nil {
+		return grant, err
+	}
+
+	if *quizId != "" {
+		grant.QuizId = orgQuizId(*quizId)
+		exists, err := quizExists(grant.QuizId)
+		if err != nil {
+			return grant, err
+		}
+		if !exists {
+			return grant, fmt.Errorf("no quiz found with ID %s", *quizId)
+		}
+	}
+	return grant, nil
+}
+
+func roleGrantCommand(args []string) error {
+	grant, err := parseRoleGrant("role grant", args)
+	if err != nil {
+		return err
+	}
+	if err := grantRole(commandOrganisation, grant); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s is now %s\n", grant.Username, grant.Role)
+	return nil
+}
+
+func roleRevokeCommand(args []string) error {
+	grant, err := parseRoleGrant("role revoke", args)
+	if err != nil {
+		return err
+	}
+	if err := revokeRole(commandOrganisation, grant); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s is no longer %s\n", grant.Username, grant.Role)
+	return nil
+}
+
+func auditListCommand(args []string) error {
+	flags := newFlagSet("audit list")
+	quizId := flags.String("quiz", "", "only show changes to this quiz")
+	limit := flags.Int("limit", 50, "number of changes to show, newest first")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	entries, err := listAudit(commandOrganisation, orgQuizId(*quizId), *limit)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "WHEN\tWHO\tACTION\tQUIZ\tDETAILS")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", entry.At, entry.Username, entry.Action, entry.QuizId, entry.Details)
+	}
+	return w.Flush()
+}
+
+// the correct answer has to be one of the four and not left empty, contestants can't choose an empty answer
+func validateCorrectAnswer(value string, answers []string) error {
+	answer, err := strconv.Atoi(value)
+	if err != nil || answer < 1 || answer > 4 {
+		return fmt.Errorf("correct answer must be between 1 and 4, got %q", value)
+	}
+	if answer > len(answers) || answers[answer-1] == "" {
+		return fmt.Errorf("correct answer %d is empty, fill it in or choose another answer", answer)
+	}
+	return nil
+}
+
+// checks the question's answers and correct answer as they will be once the changes are made
+func validateEditedAnswers(questionId int64, changes map[string]interface{}) error {
+	columns := []string{"answer_1", "answer_2", "answer_3", "answer_4", "correct_answer"}
+	changed := false
+	for _, column := range columns {
+		if _, found := changes[column]; found {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	rows, err := makeDatabaseQuery("SELECT "+strings.Join(columns, ", ")+" FROM questions WHERE question_id = ?", questionId)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return fmt.Errorf("no question found with ID %d", questionId)
+	}
+	var answers []string
+	for _, column := range columns[:4] {
+		answer, _ := rows[0][column].(string)
+		if value, found := changes[column]; found {
+			answer = value.(string)
+		}
+		answers = append(answers, answer)
+	}
+	correct := fmt.Sprint(rows[0]["correct_answer"])
+	if value, found := changes["correct_answer"]; found {
+		correct = value.(string)
+	}
+	return validateCorrectAnswer(correct, answers)
+}
+
+func backupCreateCommand(args []string) error {
+	flags := newFlagSet("backup create")
+	dir := flags.String("dir", "", "directory to write the backup to, a backups directory next to the database by default")
+	keep := flags.Int("keep", 0, "also delete all but this many of the newest backups in the directory")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" {
+		*dir = defaultBackupDir()
+	}
+
+	path, err := createBackup(*dir, time.Now())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Backed up the database to %s\n", path)
+
+	if *keep > 0 {
+		removed, err := pruneBackups(*dir, *keep)
+		for _, path := range removed {
+			fmt.Printf("Removed %s\n", path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func backupListCommand(args []string) error {
+	flags := newFlagSet("backup list")
+	dir := flags.String("dir", "", "directory the backups are in, a backups directory next to the database by default")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" {
+		*dir = defaultBackupDir()
+	}
+
+	backups, err := listBackups(*dir)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CREATED\tSIZE\tFILE")
+	for _, backup := range backups {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", backup.Created.Format(time.RFC3339), backup.Size, backup.Path)
+	}
+	return w.Flush()
+}
+
+func backupRestoreCommand(args []string) error {
+	flags := newFlagSet("backup restore")
+	file := flags.String("file", "", "backup to restore")
+	confirmed := flags.Bool("yes", false, "confirm replacing the database")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(map[string]string{"file": *file}); err != nil {
+		return err
+	}
+	if _, err := validateBackup(*file); err != nil {
+		return err
+	}
+	if !*confirmed {
+		return fmt.Errorf("this replaces %s with the backup, stop the server first and re-run with -yes to confirm", databasePath)
+	}
+
+	previous, version, err := restoreBackup(*file, time.Now())
+	if err != nil {
+		return err
+	}
+	if previous != "" {
+		fmt.Printf("Kept a copy of the previous database at %s\n", previous)
+	}
+	fmt.Printf("Restored %s (schema version %d)\n", *file, version)
+
+	applied, err := migrateDatabase()
+	if err != nil {
+		return err
+	}
+	if applied > 0 {
+		fmt.Printf("Applied %d migrations to bring it up to date\n", applied)
+	}
+	return nil
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type GroupResults struct {
+	Group  string  `json:"group"`
+	Scores []Score `json:"scores"`
+}
+
+type QuizResults struct {
+	QuizId         string         `json:"quiz_id"`
+	QuizName       string         `json:"quiz_name"`
+	TotalQuestions int64          `json:"total_questions"`
+	Exported       string         `json:"exported"`
+	Groups         []GroupResults `json:"groups"`
+}
+
+type AnswerRecord struct {
+	ContestantId   string `json:"contestant_id"`
+	ContestantName string `json:"name"`
+	Group          string `json:"group"`
+	QuestionNumber int64  `json:"question_number"`
+	QuestionText   string `json:"question"`
+	SelectedAnswer int64  `json:"selected_answer"`
+	CorrectAnswer  int64  `json:"correct_answer"`
+	Correct        bool   `json:"correct"`
+	Answered       string `json:"answered"`
+}
+
+var exportFormats = map[string]string{
+	"csv":     "text/csv; charset=utf-8",
+	"json":    "application/json",
+	"answers": "text/csv; charset=utf-8",
+	"pdf":     "application/pdf",
+}
+
+// points are what the question was worth when answered, its value times the round multiplier, stored with the answer so
+// later changes to the quiz don't rescore it, as is the correct answer it was marked against. Bonuses and penalties are
+// left to the scorer
+func saveAnswer(ctx context.Context, contestant Contestant, question Question, selectedAnswer int, correct bool) error {
+	correctValue := 0
+	if correct {
+		correctValue = 1
+	}
+	points := question.Points * question.Round.Multiplier
+	var roundId interface{}
+	if question.Round.RoundId != 0 {
+		roundId = question.Round.RoundId
+	}
+
+	// time taken is measured from when the question was last served to the contestant
+	insertQuery := `INSERT INTO answers(contestant_id, quiz_id, question_id, selected_answer, correct_answer, correct, round_id, points, time_taken_seconds)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, (SELECT (JULIANDAY('now') - JULIANDAY(question_served)) * 86400 FROM scores WHERE contestant_id = ?))`
+	_, err := makeDatabaseQueryContext(ctx, insertQuery, contestant.ContestantId, contestant.QuizId, question.QuestionId, selectedAnswer, question.CorrectAnswer, correctValue, roundId, points, contestant.ContestantId)
+	if err == nil {
+		metrics.answerRecorded(correct)
+	}
+	return err
+}
+
+// the contestant's latest answer to a question, found is false if they haven't answered it
+func getAnswer(ctx context.Context, contestantId string, questionId int64) (selectedAnswer int, correct bool, found bool, err error) {
+	rows, err := makeDatabaseQueryContext(ctx, `SELECT selected_answer, correct FROM answers WHERE contestant_id = ? AND question_id = ?
+		ORDER BY answer_id DESC LIMIT 1`, contestantId, questionId)
+	if err != nil || len(rows) == 0 {
+		return 0, false, false, err
+	}
+	selected, _ := rows[0]["selected_answer"].(int64)
+	correctValue, _ := rows[0]["correct"].(int64)
+	return int(selected), correctValue == 1, true, nil
+}
+
+// gathers the scoreboard for one group, or every group in the quiz if group is empty
+func getQuizResults(quizId string, group string) (QuizResults, error) {
+	results := QuizResults{
+		QuizId:   quizId,
+		Exported: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	quizResult, err := makeDatabaseQuery("SELECT name, (SELECT COUNT(*) FROM quiz_questions WHERE quiz_id = ? AND active = 1) AS total_questions FROM quizzes WHERE quiz_id = ?", quizId, quizId)
+	if err != nil {
+		return results, err
+	}
+	if len(quizResult) == 0 {
+		return results, fmt.Errorf("no quiz found with ID %s", quizId)
+	}
+	results.QuizName = quizResult[0]["name"].(string)
+	results.TotalQuestions = quizResult[0]["total_questions"].(int64)
+
+	groups := []string{strings.ToLower(group)}
+	if group == "" {
+		groups, err = listGroups(quizId)
+		if err != nil {
+			return results, err
+		}
+	}
+
+	for _, groupName := range groups {
+		results.Groups = append(results.Groups, GroupResults{
+			Group:  groupName,
+			Scores: getGroupScores(quizId, groupName),
+		})
+	}
+
+	return results, nil
+}
+
+// per answer breakdown, only available for answers given after individual answers started being recorded. The correct
+// answer is the one the answer was marked against, answers saved before that was kept fall back to the question's
+func getAnswerBreakdown(quizId string, group string) ([]AnswerRecord, error) {
+	breakdownQuery := `SELECT answers.contestant_id, scores.name, scores."group", quiz_questions.sort_order, questions.question,
+		answers.selected_answer, COALESCE(answers.correct_answer, questions.correct_answer) AS correct_answer, answers.correct, answers.answered
+		FROM answers
+		INNER JOIN scores ON scores.contestant_id = answers.contestant_id
+		INNER JOIN questions ON questions.question_id = answers.question_id
+		LEFT JOIN quiz_questions ON quiz_questions.quiz_id = answers.quiz_id AND quiz_questions.question_id = answers.question_id
+		WHERE answers.quiz_id = ?
+		AND (? = '' OR scores."group" = ?)
+		ORDER BY scores."group", scores.name, quiz_questions.sort_order`
+	rows, err := makeDatabaseQuery(breakdownQuery, quizId, strings.ToLower(group), strings.ToLower(group))
+	if err != nil {
+		return nil, err
+	}
+
+	var records []AnswerRecord
+	for _, row := range rows {
+		// questions removed from the quiz since being answered no longer have a number
+		questionNumber, _ := row["sort_order"].(int64)
+		records = append(records, AnswerRecord{
+			ContestantId:   row["contestant_id"].(string),
+			ContestantName: row["name"].(string),
+			Group:          row["group"].(string),
+			QuestionNumber: questionNumber,
+			QuestionText:   row["question"].(string),
+			SelectedAnswer: row["selected_answer"].(int64),
+			CorrectAnswer:  row["correct_answer"].(int64),
+			Correct:        row["correct"].(int64) == 1,
+			Answered:       fmt.Sprint(row["answered"]),
+		})
+	}
+
+	return records, nil
+}
+
+// winners are everyone the quiz's scorer can't separate from first place in each group, their certificates show the points
+// the scorer ranked them by
+func getCertificates(results QuizResults) ([]Certificate, error) {
+	var certificates []Certificate
+	date := time.Now().Format("2 January 2006")
+
+	quizDetails, err := getQuiz(results.QuizId)
+	if err != nil {
+		return nil, err
+	}
+	scorer := newScorer(quizDetails)
+
+	for _, group := range results.Groups {
+		for _, score := range group.Scores {
+			if scorer.compare(score, group.Scores[0]) != 0 {
+				break
+			}
+			certificates = append(certificates, Certificate{
+				QuizName:       results.QuizName,
+				Group:          group.Group,
+				ContestantName: score.ContestantName,
+				CorrectAnswers: score.CorrectAnswers,
+				TotalQuestions: score.TotalQuestions,
+				Points:         score.Points,
+				MaxPoints:      score.MaxPoints,
+				TimeTaken:      score.TimeTaken,
+				Date:           date,
+			})
+		}
+	}
+
+	return certificates, nil
+}
+
+// names, groups and question text are typed in by people, a spreadsheet would run one starting like a formula as one
+func csvText(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func writeResultsCSV(w io.Writer, results QuizResults) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"quiz_id", "group", "rank", "contestant_id", "name", "correct_answers", "total_questions", "points", "time_taken"})
+	for _, group := range results.Groups {
+		for i, score := range group.Scores {
+			writer.Write([]string{
+				publicQuizId(results.QuizId),
+				csvText(group.Group),
+				strconv.Itoa(i + 1),
+				score.ContestantId,
+				csvText(score.ContestantName),
+				strconv.FormatInt(score.CorrectAnswers, 10),
+				strconv.FormatInt(score.TotalQuestions, 10),
+				strconv.FormatFloat(score.Points, 'f', -1, 64),
+				score.TimeTaken,
+			})
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func writeResultsJSON(w io.Writer, results QuizResults) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	results.QuizId = publicQuizId(results.QuizId)
+	return encoder.Encode(results)
+}
+
+func writeAnswersCSV(w io.Writer, quizId string, records []AnswerRecord) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"quiz_id", "group", "contestant_id", "name", "question_number", "question", "selected_answer", "correct_answer", "correct", "answered"})
+	for _, record := range records {
+		writer.Write([]string{
+			publicQuizId(quizId),
+			csvText(record.Group),
+			record.ContestantId,
+			csvText(record.ContestantName),
+			strconv.FormatInt(record.QuestionNumber, 10),
+			csvText(record.QuestionText),
+			strconv.FormatInt(record.SelectedAnswer, 10),
+			strconv.FormatInt(record.CorrectAnswer, 10),
+			strconv.FormatBool(record.Correct),
+			record.Answered,
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// writes the results for the quiz (or a single group) in the requested format, shared by the export endpoint and CLI
+func writeExport(w io.Writer, quizId string, group string, format string) error {
+	switch format {
+	case "answers":
+		records, err := getAnswerBreakdown(quizId, group)
+		if err != nil {
+			return err
+		}
+		return writeAnswersCSV(w, quizId, records)
+	case "csv", "json", "pdf":
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+
+	results, err := getQuizResults(quizId, group)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "json":
+		return writeResultsJSON(w, results)
+	case "pdf":
+		certificates, err := getCertificates(results)
+		if err != nil {
+			return err
+		}
+		if len(certificates) == 0 {
+			return fmt.Errorf("no finished contestants in %s to award certificates to", quizId)
+		}
+		return writeCertificatesPDF(w, certificates)
+	default:
+		return writeResultsCSV(w, results)
+	}
+}
+
+func exportFilename(quizId string, group string, format string) string {
+	name := publicQuizId(quizId)
+	if group != "" {
+		name += "-" + strings.ToLower(group)
+	}
+
+	switch format {
+	case "answers":
+		return name + "-answers.csv"
+	case "pdf":
+		return name + "-certificates.pdf"
+	default:
+		return name + "." + format
+	}
+}
+
+// handles GET /export/{quiz}/?group=<group>&format=csv|json|answers|pdf
+func exportResults(w http.ResponseWriter, r *http.Request) {
+	quizId, _ := requestQuiz(r)
+
+	group := r.URL.Query().Get("group")
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	contentType, found := exportFormats[format]
+	if !found {
+		http.Error(w, "Unknown export format", http.StatusBadRequest)
+		return
+	}
+
+	// build the export first so a failure doesn't leave a half written download
+	var export strings.Builder
+	if err := writeExport(&export, quizId, group, format); err != nil {
+		requestLogger(r).Error("Error exporting results", "quiz_id", quizId, "error", err)
+		http.Error(w, "The results couldn't be exported", http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", exportFilename(quizId, group, format)))
+	io.WriteString(w, export.String())
+}
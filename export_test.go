@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+func readCSV(t *testing.T, text string) [][]string {
+	t.Helper()
+	records, err := csv.NewReader(strings.NewReader(text)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestExportsDontStartCellsWithFormulas(t *testing.T) {
+	results := QuizResults{QuizId: "christmas", Groups: []GroupResults{{
+		Group: "+legal",
+		Scores: []Score{
+			{ContestantId: "aWQ=", ContestantName: `=HYPERLINK("http://evil.example.com","Click")`, TimeTaken: "00:01:00"},
+			{ContestantId: "aWQy", ContestantName: "Rita = Sam", TimeTaken: "00:02:00"},
+		},
+	}}}
+	var written strings.Builder
+	if err := writeResultsCSV(&written, results); err != nil {
+		t.Fatal(err)
+	}
+	records := readCSV(t, written.String())
+	if got := records[1][4]; got != `'=HYPERLINK("http://evil.example.com","Click")` {
+		t.Errorf("got name %q, want it quoted so it isn't a formula", got)
+	}
+	if records[1][1] != "'+legal" || records[2][4] != "Rita = Sam" {
+		t.Errorf("got group %q and name %q", records[1][1], records[2][4])
+	}
+
+	written.Reset()
+	answers := []AnswerRecord{{ContestantName: "@SUM(A1:A9)", Group: "legal", QuestionText: "-1 plus 1", Answered: "2024-12-24 19:00:00"}}
+	if err := writeAnswersCSV(&written, "christmas", answers); err != nil {
+		t.Fatal(err)
+	}
+	records = readCSV(t, written.String())
+	if records[1][3] != "'@SUM(A1:A9)" || records[1][5] != "'-1 plus 1" {
+		t.Errorf("got name %q and question %q", records[1][3], records[1][5])
+	}
+}
+
+func TestAnswersExportKeepsTheCorrectAnswerMarkedAgainst(t *testing.T) {
+	useTestDatabase(t)
+	questionIds := addTestQuiz(t, "export", "Export", arithmeticQuestions)
+	contestantId := addFinishedContestant(t, "export", "Rita", "legal", []bool{false, false, true}, []float64{5, 5, 5})
+	// answer 1 was right for the last question until it was edited
+	if err := updateQuestion(questionIds[2], map[string]interface{}{"correct_answer": "2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := getAnswerBreakdown("export", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d answers, want 3", len(records))
+	}
+	if last := records[2]; last.ContestantId != contestantId || last.CorrectAnswer != 1 || !last.Correct {
+		t.Errorf("got %+v, want the correct answer it was marked against", last)
+	}
+}
+
+func TestCertificatesShowThePointsThatWon(t *testing.T) {
+	useTestDatabase(t)
+	questionIds := addTestQuiz(t, "export", "Export", arithmeticQuestions)
+	if err := updateQuizQuestion("export", questionIds[0], map[string]interface{}{"points": 3}); err != nil {
+		t.Fatal(err)
+	}
+	// one right answer worth 3 beats two worth 1 each
+	addFinishedContestant(t, "export", "Rita", "legal", []bool{true, false, false}, []float64{5, 5, 5})
+	addFinishedContestant(t, "export", "Sam", "legal", []bool{false, true, true}, []float64{5, 5, 5})
+
+	results, err := getQuizResults("export", "legal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificates, err := getCertificates(results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certificates) != 1 || certificates[0].ContestantName != "Rita" {
+		t.Fatalf("got certificates %+v, want one for Rita", certificates)
+	}
+	if page := string(certificatePageContent(certificates[0], 842, 595)); !strings.Contains(page, "3 out of 5 points") {
+		t.Errorf("certificate doesn't show the points that won: %s", page)
+	}
+}
@@ -1,5 +1,5 @@
 module quiz-go-htmx
 
-go 1.21.4
+go 1.22
 
 require github.com/mattn/go-sqlite3 v1.14.18
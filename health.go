@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	// slow clients can't hold connections open, exports and PDFs get the longest to be written
+	readHeaderTimeout = 5 * time.Second
+	readTimeout       = 15 * time.Second
+	writeTimeout      = 60 * time.Second
+	idleTimeout       = 120 * time.Second
+	// how long requests already being handled, e.g. answers being saved, get to finish after SIGTERM. Fly's
+	// kill_timeout needs to be longer
+	shutdownTimeout = 25 * time.Second
+	// readiness checks give up on a database that takes longer than this
+	readinessTimeout = 2 * time.Second
+)
+
+// set once the server starts shutting down, so load balancers stop sending new requests before it stops
+var shuttingDown atomic.Bool
+
+// handles GET /healthz, the process is up and serving. Doesn't touch the database so a slow one doesn't get the
+// machine restarted
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintln(w, "ok")
+}
+
+// the database can be reached and has every migration applied
+func checkReadiness(ctx context.Context) error {
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := db.PingContext(ctx); err != nil {
+		return fmt.Errorf("database unreachable: %w", err)
+	}
+	var version int
+	if err := db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+	if version != latestSchemaVersion() {
+		return fmt.Errorf("schema is at version %d, expected %d", version, latestSchemaVersion())
+	}
+	return nil
+}
+
+// handles GET /readyz, ready to take contestants
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	if shuttingDown.Load() {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+	if err := checkReadiness(ctx); err != nil {
+		requestLogger(r).Warn("Not ready", "error", err)
+		http.Error(w, "not ready: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ready")
+}
+
+// serves until SIGTERM or SIGINT, then stops accepting connections and waits for the requests in progress to finish
+func listenAndServe(server *http.Server) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down, waiting for requests in progress", "timeout", shutdownTimeout.String())
+	shuttingDown.Store(true)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutting down: %w", err)
+	}
+	slog.Info("Server stopped")
+	return nil
+}
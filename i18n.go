@@ -0,0 +1,317 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed locales/*.json
+var embeddedLocales embed.FS
+
+// pages are shown in English when the quiz has no locale and the browser doesn't ask for one we have
+const defaultLocale = "en"
+
+// the messages for one locale. In the JSON files a message is a string, an object of plural forms keyed by
+// "one"/"other", or a list (used for the preset feedback messages and day and month names)
+type Catalog struct {
+	Locale   string
+	messages map[string]string
+	plurals  map[string]map[string]string
+	lists    map[string][]string
+}
+
+var (
+	catalogs     map[string]*Catalog
+	catalogsErr  error
+	catalogsOnce sync.Once
+)
+
+func parseCatalog(locale string, content []byte) (*Catalog, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return nil, err
+	}
+
+	catalog := &Catalog{
+		Locale:   locale,
+		messages: map[string]string{},
+		plurals:  map[string]map[string]string{},
+		lists:    map[string][]string{},
+	}
+	for key, value := range raw {
+		var message string
+		var plural map[string]string
+		var list []string
+		if err := json.Unmarshal(value, &message); err == nil {
+			catalog.messages[key] = message
+		} else if err := json.Unmarshal(value, &plural); err == nil {
+			if _, found := plural["other"]; !found {
+				return nil, fmt.Errorf("plural message %s has no \"other\" form", key)
+			}
+			catalog.plurals[key] = plural
+		} else if err := json.Unmarshal(value, &list); err == nil {
+			catalog.lists[key] = list
+		} else {
+			return nil, fmt.Errorf("message %s must be a string, plural forms or a list", key)
+		}
+	}
+	return catalog, nil
+}
+
+// reads every catalog in locales/, the English one has every message and the others fall back to it
+func loadCatalogs() (map[string]*Catalog, error) {
+	catalogsOnce.Do(func() {
+		catalogs = map[string]*Catalog{}
+		files, err := fs.Glob(embeddedLocales, "locales/*.json")
+		if err != nil {
+			catalogsErr = err
+			return
+		}
+		for _, file := range files {
+			content, err := fs.ReadFile(embeddedLocales, file)
+			if err != nil {
+				catalogsErr = err
+				return
+			}
+			locale := strings.TrimSuffix(path.Base(file), ".json")
+			catalog, err := parseCatalog(locale, content)
+			if err != nil {
+				catalogsErr = fmt.Errorf("parsing %s: %w", file, err)
+				return
+			}
+			catalogs[locale] = catalog
+		}
+		if _, found := catalogs[defaultLocale]; !found {
+			catalogsErr = fmt.Errorf("no catalog for the default locale %s", defaultLocale)
+		}
+	})
+	return catalogs, catalogsErr
+}
+
+func supportedLocales() []string {
+	loaded, _ := loadCatalogs()
+	var locales []string
+	for locale := range loaded {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+func validateLocale(locale string) error {
+	loaded, err := loadCatalogs()
+	if err != nil {
+		return err
+	}
+	if _, found := loaded[locale]; locale != "" && !found {
+		return fmt.Errorf("locale must be one of %s, got %q", strings.Join(supportedLocales(), ", "), locale)
+	}
+	return nil
+}
+
+// the CLDR plural category for a count, only covering the languages there are catalogs for
+func pluralCategory(locale string, count int64) string {
+	switch locale {
+	case "fr":
+		if count == 0 || count == 1 {
+			return "one"
+		}
+	default:
+		if count == 1 {
+			return "one"
+		}
+	}
+	return "other"
+}
+
+// picks the best locale we have a catalog for from an Accept-Language header, e.g. "fr-CA,fr;q=0.9,en;q=0.8"
+func negotiateLocale(header string) string {
+	loaded, _ := loadCatalogs()
+	type preference struct {
+		locale  string
+		quality float64
+	}
+
+	var preferences []preference
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if value, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		// catalogs are per language, so fr-CA is served the fr catalog
+		language, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if _, found := loaded[language]; found && quality > 0 {
+			preferences = append(preferences, preference{language, quality})
+		}
+	}
+	if len(preferences) == 0 {
+		return defaultLocale
+	}
+	sort.SliceStable(preferences, func(i, j int) bool {
+		return preferences[i].quality > preferences[j].quality
+	})
+	return preferences[0].locale
+}
+
+// looks up messages for one locale, used by the templates as {{ .T.Text "home.start" }}
+type Translator struct {
+	Locale string
+}
+
+func (t Translator) catalogs() (*Catalog, *Catalog) {
+	loaded, _ := loadCatalogs()
+	return loaded[t.Locale], loaded[defaultLocale]
+}
+
+// replaces {name} placeholders, args are pairs of name and value
+func fillPlaceholders(message string, args []interface{}) string {
+	for i := 0; i+1 < len(args); i += 2 {
+		message = strings.ReplaceAll(message, "{"+fmt.Sprint(args[i])+"}", fmt.Sprint(args[i+1]))
+	}
+	return message
+}
+
+// the message for the key with its placeholders filled in, e.g. Text("question.number", "number", 2, "total", 10).
+// Messages missing from the locale's catalog come from the English one
+func (t Translator) Text(key string, args ...interface{}) string {
+	catalog, fallback := t.catalogs()
+	for _, c := range []*Catalog{catalog, fallback} {
+		if c == nil {
+			continue
+		}
+		if message, found := c.messages[key]; found {
+			return fillPlaceholders(message, args)
+		}
+	}
+	slog.Warn("No translation", "key", key)
+	return key
+}
+
+// the plural form of the message for the count, which is also available to the message as {count}
+func (t Translator) Plural(key string, count interface{}, args ...interface{}) string {
+	n, _ := strconv.ParseInt(fmt.Sprint(count), 10, 64)
+	args = append([]interface{}{"count", count}, args...)
+	catalog, fallback := t.catalogs()
+	for _, c := range []*Catalog{catalog, fallback} {
+		if c == nil {
+			continue
+		}
+		forms, found := c.plurals[key]
+		if !found {
+			continue
+		}
+		if message, found := forms[pluralCategory(c.Locale, n)]; found {
+			return fillPlaceholders(message, args)
+		}
+		return fillPlaceholders(forms["other"], args)
+	}
+	slog.Warn("No translation", "key", key)
+	return key
+}
+
+// a list of messages, empty if neither the locale nor English has it
+func (t Translator) List(key string) []string {
+	catalog, fallback := t.catalogs()
+	for _, c := range []*Catalog{catalog, fallback} {
+		if c != nil && len(c.lists[key]) > 0 {
+			return c.lists[key]
+		}
+	}
+	return nil
+}
+
+// a schedule time in the locale's words, e.g. "Monday 2 January at 15:04 UTC"
+func (t Translator) Date(at time.Time) string {
+	weekday, month := at.Weekday().String(), at.Month().String()
+	if weekdays := t.List("date.weekdays"); len(weekdays) == 7 {
+		weekday = weekdays[at.Weekday()]
+	}
+	if months := t.List("date.months"); len(months) == 12 {
+		month = months[at.Month()-1]
+	}
+	return t.Text("date.format", "weekday", weekday, "day", at.Day(), "month", month, "time", at.Format("15:04"), "zone", at.Format("MST"))
+}
+
+// the translator for a quiz's pages, in the quiz's own locale if it has one or the best match for the browser
+func requestTranslator(r *http.Request, quizId string) Translator {
+	quizDetails, err := getQuiz(quizId)
+	if err != nil {
+		requestLogger(r).Error("Error getting quiz details", "quiz_id", quizId, "error", err)
+	}
+	if quizDetails.Locale != "" {
+		return Translator{Locale: quizDetails.Locale}
+	}
+	return Translator{Locale: negotiateLocale(r.Header.Get("Accept-Language"))}
+}
+
+// the question's text and answers in the locale, where a translation has been added. Answers keep their numbers so
+// grading is unaffected
+func translateQuestion(question Question, locale string) Question {
+	rows, err := makeDatabaseQuery(`SELECT question, answer_1, answer_2, answer_3, answer_4 FROM question_translations
+		WHERE question_id = ? AND locale = ?`, question.QuestionId, locale)
+	if err != nil {
+		slog.Error("Error getting translation for question", "question_id", question.QuestionId, "error", err)
+		return question
+	}
+	if len(rows) == 0 {
+		return question
+	}
+
+	if text, _ := rows[0]["question"].(string); text != "" {
+		question.QuestionText = text
+	}
+	answers := make([]Answer, len(question.Answers))
+	for i, answer := range question.Answers {
+		if text, _ := rows[0][fmt.Sprintf("answer_%d", answer.Number)].(string); text != "" {
+			answer.Text = text
+		}
+		answers[i] = answer
+	}
+	question.Answers = answers
+	return question
+}
+
+// adds or replaces a question's translation, answers left empty are shown untranslated
+func setQuestionTranslation(questionId int64, locale string, question string, answers [4]string) error {
+	if err := validateLocale(locale); err != nil {
+		return err
+	}
+	if locale == "" {
+		return fmt.Errorf("a locale is required for a translation")
+	}
+	_, err := makeDatabaseQuery(`INSERT OR REPLACE INTO question_translations(question_id, locale, question, answer_1, answer_2,
+		answer_3, answer_4) VALUES (?, ?, ?, ?, ?, ?, ?)`, questionId, locale, question, answers[0], answers[1], answers[2], answers[3])
+	return err
+}
+
+func removeQuestionTranslation(questionId int64, locale string) error {
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	result, err := db.Exec("DELETE FROM question_translations WHERE question_id = ? AND locale = ?", questionId, locale)
+	if err != nil {
+		return err
+	}
+	if removed, _ := result.RowsAffected(); removed == 0 {
+		return fmt.Errorf("question %d has no %s translation", questionId, locale)
+	}
+	return nil
+}
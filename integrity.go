@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// correct answers given in less than this share of the group's median time for the question are flagged as too quick
+	fastAnswerShare = 0.25
+	// the group's median only means something once this many of them have answered the question
+	fastAnswerMinimumAnswers = 3
+	// a phone left locked overnight is no more suspicious than one left for an hour, and shouldn't swamp the totals
+	maxSecondsAway = 3600
+)
+
+// a correct answer that came much quicker than the rest of the group's
+type FastAnswer struct {
+	QuestionText  string
+	Seconds       float64
+	MedianSeconds float64
+}
+
+// what an admin reviewing a contestant's score sees, and what they have decided about it so far
+type IntegrityReview struct {
+	ContestantId string
+	Name         string
+	Group        string
+	Finished     bool
+	TimesAway    int64
+	SecondsAway  float64
+	FastAnswers  []FastAnswer
+	Note         string
+	Penalty      float64
+	Disqualified bool
+}
+
+// flagged scores have something for an admin to look at, they are never penalised automatically
+func (review IntegrityReview) Flagged() bool {
+	return review.TimesAway > 0 || len(review.FastAnswers) > 0
+}
+
+func (review IntegrityReview) Reviewed() bool {
+	return review.Note != "" || review.Penalty != 0 || review.Disqualified
+}
+
+// records the contestant coming back to the quiz after the page was hidden or lost focus while on a question
+func recordTimeAway(ctx context.Context, contestant Contestant, question int, seconds float64) error {
+	seconds = math.Min(seconds, maxSecondsAway)
+	_, err := makeDatabaseQueryContext(ctx, "INSERT INTO integrity_events(contestant_id, quiz_id, question, seconds_away) VALUES (?, ?, ?, ?)",
+		contestant.ContestantId, contestant.QuizId, question, seconds)
+	return err
+}
+
+// contestants in the quiz who have been flagged or already reviewed, by group and then name
+func getIntegrityReviews(quizId string) ([]IntegrityReview, error) {
+	scoreRows, err := makeDatabaseQuery(`SELECT contestant_id, name, "group", finished, review_note, penalty, disqualified
+		FROM scores WHERE quiz_id = ? ORDER BY "group", name`, quizId)
+	if err != nil {
+		return nil, err
+	}
+
+	eventRows, err := makeDatabaseQuery(`SELECT contestant_id, COUNT(*) AS times_away, SUM(seconds_away) AS seconds_away
+		FROM integrity_events WHERE quiz_id = ? GROUP BY contestant_id`, quizId)
+	if err != nil {
+		return nil, err
+	}
+	timesAway := map[string]int64{}
+	secondsAway := map[string]float64{}
+	for _, row := range eventRows {
+		timesAway[row["contestant_id"].(string)] = row["times_away"].(int64)
+		secondsAway[row["contestant_id"].(string)], _ = row["seconds_away"].(float64)
+	}
+
+	// only the first answer a contestant gives to a question counts, as on the scoreboard
+	answerRows, err := makeDatabaseQuery(`SELECT answers.contestant_id, scores."group", answers.question_id, questions.question,
+		answers.correct, answers.time_taken_seconds
+		FROM answers
+		INNER JOIN scores ON scores.contestant_id = answers.contestant_id
+		INNER JOIN questions ON questions.question_id = answers.question_id
+		WHERE answers.quiz_id = ?
+		AND answers.answer_id = (SELECT MIN(first.answer_id) FROM answers AS first WHERE first.contestant_id = answers.contestant_id AND first.question_id = answers.question_id)
+		ORDER BY answers.answer_id`, quizId)
+	if err != nil {
+		return nil, err
+	}
+
+	type groupQuestion struct {
+		group      string
+		questionId int64
+	}
+	timings := map[groupQuestion][]float64{}
+	for _, row := range answerRows {
+		if seconds, timed := row["time_taken_seconds"].(float64); timed {
+			key := groupQuestion{row["group"].(string), row["question_id"].(int64)}
+			timings[key] = append(timings[key], seconds)
+		}
+	}
+
+	fastAnswers := map[string][]FastAnswer{}
+	for _, row := range answerRows {
+		seconds, timed := row["time_taken_seconds"].(float64)
+		key := groupQuestion{row["group"].(string), row["question_id"].(int64)}
+		if !timed || row["correct"].(int64) != 1 || len(timings[key]) < fastAnswerMinimumAnswers {
+			continue
+		}
+		groupMedian := median(timings[key])
+		if seconds < groupMedian*fastAnswerShare {
+			contestantId := row["contestant_id"].(string)
+			fastAnswers[contestantId] = append(fastAnswers[contestantId], FastAnswer{
+				QuestionText:  row["question"].(string),
+				Seconds:       seconds,
+				MedianSeconds: groupMedian,
+			})
+		}
+	}
+
+	var reviews []IntegrityReview
+	for _, row := range scoreRows {
+		contestantId := row["contestant_id"].(string)
+		review := IntegrityReview{
+			ContestantId: contestantId,
+			Name:         row["name"].(string),
+			Group:        row["group"].(string),
+			Finished:     row["finished"] != nil,
+			TimesAway:    timesAway[contestantId],
+			SecondsAway:  secondsAway[contestantId],
+			FastAnswers:  fastAnswers[contestantId],
+			Note:         row["review_note"].(string),
+			Penalty:      row["penalty"].(float64),
+			Disqualified: row["disqualified"].(int64) == 1,
+		}
+		if review.Flagged() || review.Reviewed() {
+			reviews = append(reviews, review)
+		}
+	}
+	sort.SliceStable(reviews, func(i, j int) bool {
+		return reviews[i].Group < reviews[j].Group
+	})
+	return reviews, nil
+}
+
+// saves an admin's decision on a score, a penalty is taken off the contestant's points and disqualified contestants are
+// left off the scoreboard
+func reviewScore(quizId string, contestantId string, note string, penalty float64, disqualified bool) error {
+	disqualifiedValue := 0
+	if disqualified {
+		disqualifiedValue = 1
+	}
+
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	result, err := db.Exec("UPDATE scores SET review_note = ?, penalty = ?, disqualified = ? WHERE quiz_id = ? AND contestant_id = ?",
+		note, penalty, disqualifiedValue, quizId, contestantId)
+	if err != nil {
+		return err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return fmt.Errorf("no contestant found with ID %s", contestantId)
+	}
+	return nil
+}
+
+// handles POST /integrity/, sent by quiz.js when the contestant comes back to the quiz after leaving it. Reports for
+// quizzes without integrity checks, or after the contestant has finished, are ignored
+func integrityReportHandler(w http.ResponseWriter, r *http.Request) {
+	contestantId := r.PostFormValue("contestant-id")
+	if cookie, err := r.Cookie("contestant-id"); err == nil && contestantId == "" {
+		contestantId = cookie.Value
+	}
+	contestantDetails := getContestantDetails(r.Context(), contestantId)
+	if !quizInRequestOrganisation(r, contestantDetails.QuizId) {
+		http.NotFound(w, r)
+		return
+	}
+
+	question, err := strconv.Atoi(r.PostFormValue("question"))
+	if err != nil || question < 1 {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	seconds, err := strconv.ParseFloat(r.PostFormValue("seconds"), 64)
+	if err != nil || seconds <= 0 || math.IsInf(seconds, 0) || math.IsNaN(seconds) {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	quizDetails, err := getQuiz(contestantDetails.QuizId)
+	if err != nil {
+		requestLogger(r).Error("Error getting quiz details", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if quizDetails.IntegrityChecks && contestantDetails.Finished == "" {
+		if err := recordTimeAway(r.Context(), contestantDetails, question, seconds); err != nil {
+			requestLogger(r).Error("Error recording time away", "contestant_id", contestantId, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handles GET and POST /review/{quiz}/, lists the flagged scores and saves the admin's note, penalty or disqualification
+func reviewHandler(w http.ResponseWriter, r *http.Request) {
+	quizId := quizFromPath(r)
+	var message string
+	var showError bool
+
+	if r.Method == "POST" {
+		contestantId := r.PostFormValue("contestant-id")
+		note := strings.TrimSpace(r.PostFormValue("note"))
+		disqualified := r.PostFormValue("disqualified") == "1"
+		penalty, err := strconv.ParseFloat(r.PostFormValue("penalty"), 64)
+		if r.PostFormValue("penalty") == "" {
+			penalty, err = 0, nil
+		}
+
+		if err != nil || penalty < 0 || math.IsInf(penalty, 0) {
+			message = "The penalty must be 0 or more points"
+			showError = true
+		} else if err := reviewScore(quizId, contestantId, note, penalty, disqualified); err != nil {
+			requestLogger(r).Error("Error saving review", "quiz_id", quizId, "contestant_id", contestantId, "error", err)
+			message = "There was a problem saving the review"
+			showError = true
+		} else {
+			name := getContestantDetails(r.Context(), contestantId).ContestantName
+			message = "Saved the review for " + name
+			recordWebAudit(r, "score review", quizId, fmt.Sprintf("%s: penalty %g, disqualified %t", name, penalty, disqualified))
+		}
+	}
+
+	reviews, err := getIntegrityReviews(quizId)
+	if err != nil {
+		requestLogger(r).Error("Error getting reviews", "quiz_id", quizId, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	quizDetails, err := getQuiz(quizId)
+	if err != nil {
+		requestLogger(r).Error("Error getting quiz details", "quiz_id", quizId, "error", err)
+	}
+
+	tmpl, err := pageTemplates.get("review")
+	if err != nil {
+		requestLogger(r).Error("Error rendering template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+		"QuizTitle":       quizDetails.Name,
+		"QuizId":          publicQuizId(quizId),
+		"OrgPath":         requestOrganisation(r).BasePath,
+		"Theme":           requestTheme(r, quizId),
+		"IntegrityChecks": quizDetails.IntegrityChecks,
+		"Reviews":         reviews,
+		"FastAnswerShare": fastAnswerShare * 100,
+		"Message":         message,
+		"ShowError":       showError,
+	})
+	if err != nil {
+		requestLogger(r).Error("Error rendering template", "error", err)
+	}
+}
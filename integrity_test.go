@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// finishes the quiz for a new contestant, answering every question with the seconds taken on each
+func addFinishedContestant(t *testing.T, quizId string, name string, group string, correct []bool, seconds []float64) string {
+	t.Helper()
+	contestantId := createContestant(quizId, name, group)
+	details := getContestantDetails(context.Background(), contestantId)
+	correctAnswers := 0
+	for i := range correct {
+		_, question := getQuestionDetails(quizId, details, i+1)
+		if err := saveAnswer(context.Background(), details, question, 1, correct[i]); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := makeDatabaseQuery("UPDATE answers SET time_taken_seconds = ? WHERE contestant_id = ? AND question_id = ?", seconds[i], contestantId, question.QuestionId); err != nil {
+			t.Fatal(err)
+		}
+		if correct[i] {
+			correctAnswers++
+		}
+	}
+	_, err := makeDatabaseQuery(`UPDATE scores SET started = DATETIME('now', '-5 minutes'), finished = DATETIME('now'),
+		correct_answers = ?, questions_answered = ? WHERE contestant_id = ?`, correctAnswers, len(correct), contestantId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return contestantId
+}
+
+func TestIntegrityReviewFlagsFastAnswers(t *testing.T) {
+	useTestDatabase(t)
+	addTestQuiz(t, "integrity", "Integrity", arithmeticQuestions)
+
+	allCorrect := []bool{true, true, true}
+	addFinishedContestant(t, "integrity", "Steady", "legal", allCorrect, []float64{20, 30, 25})
+	addFinishedContestant(t, "integrity", "Careful", "legal", allCorrect, []float64{24, 28, 30})
+	// a wrong answer however quick isn't worth flagging
+	quick := addFinishedContestant(t, "integrity", "Quick", "legal", []bool{true, false, true}, []float64{2, 1, 22})
+	// other groups have their own medians, nobody else in finance has answered so nothing can be compared
+	addFinishedContestant(t, "integrity", "Alone", "finance", allCorrect, []float64{1, 1, 1})
+
+	reviews, err := getIntegrityReviews("integrity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reviews) != 1 || reviews[0].ContestantId != quick {
+		t.Fatalf("got reviews %+v, want only Quick", reviews)
+	}
+	fast := reviews[0].FastAnswers
+	if len(fast) != 1 || fast[0].QuestionText != "What is two plus two" || fast[0].Seconds != 2 || fast[0].MedianSeconds != 20 {
+		t.Errorf("got fast answers %+v, want two plus two in 2s against a median of 20s", fast)
+	}
+}
+
+func TestIntegrityReport(t *testing.T) {
+	useTestDatabase(t)
+	addTestQuiz(t, "integrity", "Integrity", arithmeticQuestions)
+	server := newTestServer(t)
+	contestantId := createContestant("integrity", "Rita", "legal")
+
+	report := func(values url.Values) int {
+		status, _, _ := postForm(t, newTestClient(t), server.URL+"/integrity/", values, false)
+		return status
+	}
+	away := url.Values{"contestant-id": {contestantId}, "question": {"2"}, "seconds": {"7200"}}
+
+	// reports are accepted but not kept until the quiz turns integrity checks on
+	if status := report(away); status != http.StatusNoContent {
+		t.Errorf("got status %d, want 204", status)
+	}
+	if reviews, _ := getIntegrityReviews("integrity"); len(reviews) != 0 {
+		t.Errorf("recorded %+v with integrity checks off", reviews)
+	}
+
+	if err := updateQuiz("integrity", map[string]interface{}{"integrity_checks": 1}); err != nil {
+		t.Fatal(err)
+	}
+	report(away)
+	report(url.Values{"contestant-id": {contestantId}, "question": {"3"}, "seconds": {"4.5"}})
+	for _, bad := range []url.Values{
+		{"contestant-id": {contestantId}, "question": {"3"}, "seconds": {"-4"}},
+		{"contestant-id": {contestantId}, "question": {"0"}, "seconds": {"4"}},
+		{"contestant-id": {contestantId}, "question": {"3"}, "seconds": {"NaN"}},
+	} {
+		if status := report(bad); status != http.StatusBadRequest {
+			t.Errorf("%v: got status %d, want 400", bad, status)
+		}
+	}
+	if status := report(url.Values{"contestant-id": {"nobody"}, "question": {"1"}, "seconds": {"4"}}); status != http.StatusNotFound {
+		t.Errorf("unknown contestant: got status %d, want 404", status)
+	}
+
+	reviews, err := getIntegrityReviews("integrity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// time away is capped so one long absence doesn't swamp the total
+	if len(reviews) != 1 || reviews[0].TimesAway != 2 || reviews[0].SecondsAway != maxSecondsAway+4.5 {
+		t.Errorf("got reviews %+v, want Rita away twice for %v seconds", reviews, maxSecondsAway+4.5)
+	}
+}
+
+func TestReviewPenalisesAndDisqualifies(t *testing.T) {
+	useTestDatabase(t)
+	addTestQuiz(t, "integrity", "Integrity", arithmeticQuestions)
+	allCorrect := []bool{true, true, true}
+	addFinishedContestant(t, "integrity", "Steady", "legal", allCorrect, []float64{20, 30, 25})
+	addFinishedContestant(t, "integrity", "Careful", "legal", allCorrect, []float64{24, 28, 30})
+	quick := addFinishedContestant(t, "integrity", "Quick", "legal", allCorrect, []float64{2, 1, 2})
+	key := serverOwnerKey(t)
+	server := newTestServer(t)
+	client := newTestClient(t)
+
+	status, _, body := do(t, client, adminRequest(t, http.MethodGet, server.URL+"/review/integrity/", nil, defaultOrganisation, key))
+	if status != http.StatusOK {
+		t.Fatalf("got status %d: %s", status, body)
+	}
+	expectContains(t, "review page", body, "Quick", `name="contestant-id" value="`+quick+`"`, "Integrity checks are off")
+
+	review := func(values url.Values) string {
+		values.Set("contestant-id", quick)
+		status, _, body := do(t, client, adminRequest(t, http.MethodPost, server.URL+"/review/integrity/", values, defaultOrganisation, key))
+		if status != http.StatusOK {
+			t.Fatalf("got status %d: %s", status, body)
+		}
+		return body
+	}
+
+	body = review(url.Values{"note": {"Answers in a second or two"}, "penalty": {"-1"}})
+	expectContains(t, "negative penalty", body, "The penalty must be 0 or more points")
+
+	body = review(url.Values{"note": {"Answers in a second or two"}, "penalty": {"1.5"}})
+	expectContains(t, "penalised", body, "Saved the review for Quick", "Answers in a second or two", "-1.5 points")
+	scores := getGroupScores("integrity", "legal")
+	if len(scores) != 3 || scores[2].ContestantName != "Quick" || scores[2].Points != 1.5 || scores[2].Penalty != 1.5 {
+		t.Errorf("got scores %+v, want Quick last on 1.5 points", scores)
+	}
+
+	review(url.Values{"note": {"Admitted looking it up"}, "disqualified": {"1"}})
+	scores = getGroupScores("integrity", "legal")
+	if len(scores) != 2 || strings.Contains(scores[0].ContestantName+scores[1].ContestantName, "Quick") {
+		t.Errorf("got scores %+v, want Quick left off", scores)
+	}
+	// still listed for review so it can be undone
+	reviews, err := getIntegrityReviews("integrity")
+	if err != nil || len(reviews) != 1 || !reviews[0].Disqualified || reviews[0].Penalty != 0 {
+		t.Errorf("got reviews %+v (%v), want Quick disqualified", reviews, err)
+	}
+
+	rows, err := makeDatabaseQuery("SELECT details FROM audit_log WHERE action = 'score review' ORDER BY audit_id")
+	if err != nil || len(rows) != 2 || rows[1]["details"].(string) != "Quick: penalty 0, disqualified true" {
+		t.Errorf("got audit log %v (%v)", rows, err)
+	}
+}
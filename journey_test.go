@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var roundQuestions = []testQuestion{
+	{text: "What is two plus two", answers: []string{"3", "4", "5", "6"}, correct: 2, round: "Warm up"},
+	{text: "What is three times three", answers: []string{"6", "9", "12", "33"}, correct: 2, round: "Warm up"},
+	{text: "What is ten minus one", answers: []string{"9", "8", "11", "10"}, correct: 1, round: "Finale"},
+}
+
+// someone playing the quiz in a browser, with or without JavaScript
+type testPlayer struct {
+	t      *testing.T
+	client *http.Client
+	server string
+	htmx   bool
+}
+
+// submits one of the quiz's forms and returns what the player sees next. htmx swaps in a fragment of the page, without
+// JavaScript the post is redirected to a page that can be refreshed without posting again
+func (player testPlayer) submit(path string, values url.Values) string {
+	t := player.t
+	t.Helper()
+	status, location, body := postForm(t, player.client, player.server+path, values, player.htmx)
+	if player.htmx {
+		if status != http.StatusOK {
+			t.Fatalf("POST %s: got status %d, want 200: %s", path, status, body)
+		}
+		if strings.Contains(body, "<html") {
+			t.Fatalf("POST %s: htmx should get a fragment, got a whole page", path)
+		}
+		return body
+	}
+
+	if status != http.StatusSeeOther {
+		t.Fatalf("POST %s: got status %d, want a 303 redirect: %s", path, status, body)
+	}
+	return player.page(location)
+}
+
+// gets a whole page the player was sent to
+func (player testPlayer) page(path string) string {
+	t := player.t
+	t.Helper()
+	status, _, body := get(t, player.client, player.server+path)
+	if status != http.StatusOK {
+		t.Fatalf("GET %s: got status %d, want 200: %s", path, status, body)
+	}
+	if !strings.Contains(body, "<html") {
+		t.Fatalf("GET %s: want a whole page, got a fragment", path)
+	}
+	return body
+}
+
+func expectContains(t *testing.T, step string, body string, want ...string) {
+	t.Helper()
+	for _, text := range want {
+		if !strings.Contains(body, text) {
+			t.Errorf("%s: want %q in:\n%s", step, text, body)
+		}
+	}
+}
+
+func countAnswers(t *testing.T, contestantId string) int64 {
+	t.Helper()
+	rows, err := makeDatabaseQuery("SELECT COUNT(*) AS count FROM answers WHERE contestant_id = ?", contestantId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows[0]["count"].(int64)
+}
+
+func TestQuizJourney(t *testing.T) {
+	for _, htmx := range []bool{true, false} {
+		name := "without JavaScript"
+		if htmx {
+			name = "with htmx"
+		}
+		t.Run(name, func(t *testing.T) {
+			useTestDatabase(t)
+			addTestQuiz(t, "journey", "Journey", roundQuestions)
+			server := newTestServer(t)
+			player := testPlayer{t: t, client: newTestClient(t), server: server.URL, htmx: htmx}
+
+			// registering sets the contestant's cookie and sends them to the quiz
+			status, location, _ := postForm(t, player.client, server.URL+"/journey/legal", url.Values{"contestant-name": {"Rita"}}, false)
+			if status != http.StatusFound || location != "/quiz/journey/" {
+				t.Fatalf("registering: got %d to %q, want 302 to /quiz/journey/", status, location)
+			}
+			serverUrl, _ := url.Parse(server.URL)
+			var contestantId string
+			for _, cookie := range player.client.Jar.Cookies(serverUrl) {
+				if cookie.Name == "contestant-id" {
+					contestantId = cookie.Value
+				}
+			}
+			if contestantId != generateContestantId("Rita", "journey", "legal") {
+				t.Fatalf("got contestant cookie %q, want the ID for Rita in legal", contestantId)
+			}
+
+			body := player.page("/quiz/journey/")
+			expectContains(t, "first round intro", body, "Warm up", `name="round-intro"`)
+
+			// answers right, wrong, right
+			answers := []int{2, 1, 1}
+			for i, answer := range answers {
+				position := strconv.Itoa(i + 1)
+				if roundQuestions[i].round != "" && (i == 0 || roundQuestions[i-1].round != roundQuestions[i].round) {
+					if i > 0 {
+						expectContains(t, "round intro before question "+position, body, roundQuestions[i].round, `name="round-intro"`)
+					}
+					body = player.submit("/quiz/journey/", url.Values{"question": {strconv.Itoa(i)}, "contestant-id": {contestantId}, "round-intro": {"seen"}})
+				}
+				expectContains(t, "question "+position, body, "Question "+position+" / 3", roundQuestions[i].text, `action="/record-answer/"`)
+
+				body = player.submit("/record-answer/", url.Values{"question": {position}, "contestant-id": {contestantId}, "answers": {strconv.Itoa(answer)}})
+				grade := "Incorrect!"
+				if int64(answer) == roundQuestions[i].correct {
+					grade = "Correct!"
+				}
+				expectContains(t, "answered question "+position, body, "Question "+position+" / 3", grade, "disabled")
+
+				if i < len(answers)-1 {
+					body = player.submit("/quiz/journey/", url.Values{"question": {position}, "contestant-id": {contestantId}})
+				}
+			}
+			expectContains(t, "last question", body, `action="/scoreboard/journey/legal/?c=`)
+
+			if !htmx {
+				// refreshing the answered page shows it again without answering again
+				player.page("/quiz/journey/?answered=3")
+				if count := countAnswers(t, contestantId); count != 3 {
+					t.Errorf("got %d answers after refreshing, want 3", count)
+				}
+			}
+
+			body = player.page("/scoreboard/journey/legal/?c=" + url.QueryEscape(contestantId))
+			expectContains(t, "scoreboard", body, "Rita")
+
+			scores := getGroupScores("journey", "legal")
+			if len(scores) != 1 || scores[0].CorrectAnswers != 2 || scores[0].Points != 2 {
+				t.Errorf("got scores %+v, want Rita with 2 correct answers", scores)
+			}
+
+			// coming back after finishing goes to the scoreboard
+			status, location, _ = get(t, player.client, server.URL+"/quiz/journey/")
+			if status != http.StatusFound || !strings.HasPrefix(location, "/scoreboard/journey/legal/") {
+				t.Errorf("returning after finishing: got %d to %q, want the scoreboard", status, location)
+			}
+		})
+	}
+}
+
+func TestQuizWithoutContestantRedirectsToRegistration(t *testing.T) {
+	useTestDatabase(t)
+	addTestQuiz(t, "journey", "Journey", arithmeticQuestions)
+	server := newTestServer(t)
+
+	status, location, _ := get(t, newTestClient(t), server.URL+"/quiz/journey/")
+	if status != http.StatusSeeOther || location != "/journey/" {
+		t.Errorf("got %d to %q, want 303 to /journey/", status, location)
+	}
+}
+
+func TestRecordAnswerWithoutAnswer(t *testing.T) {
+	useTestDatabase(t)
+	addTestQuiz(t, "journey", "Journey", arithmeticQuestions)
+	server := newTestServer(t)
+	contestantId := createContestant("journey", "Rita", "legal")
+
+	for _, htmx := range []bool{true, false} {
+		status, _, body := postForm(t, newTestClient(t), server.URL+"/record-answer/", url.Values{"question": {"1"}, "contestant-id": {contestantId}}, htmx)
+		if status != http.StatusBadRequest {
+			t.Errorf("htmx %v: got status %d, want 400: %s", htmx, status, body)
+		}
+	}
+	if count := countAnswers(t, contestantId); count != 0 {
+		t.Errorf("got %d answers recorded, want none", count)
+	}
+}
+
+// posts an answer straight to /record-answer/ as a script might, returning the status
+func postAnswer(t *testing.T, server string, contestantId string, question int, answer int) int {
+	t.Helper()
+	status, _, _ := postForm(t, newTestClient(t), server+"/record-answer/",
+		url.Values{"question": {strconv.Itoa(question)}, "contestant-id": {contestantId}, "answers": {strconv.Itoa(answer)}}, true)
+	return status
+}
+
+func TestRecordAnswerSkippingAhead(t *testing.T) {
+	useTestDatabase(t)
+	addTestQuiz(t, "journey", "Journey", arithmeticQuestions)
+	server := newTestServer(t)
+	contestantId := createContestant("journey", "Rita", "legal")
+
+	// answering the last question straight away would finish the quiz early
+	if status := postAnswer(t, server.URL, contestantId, 3, 1); status != http.StatusConflict {
+		t.Errorf("got status %d, want 409", status)
+	}
+	details := getContestantDetails(context.Background(), contestantId)
+	if details.Finished != "" || details.QuestionsAnswered != 0 || countAnswers(t, contestantId) != 0 {
+		t.Errorf("got %+v with %d answers, want nothing recorded", details, countAnswers(t, contestantId))
+	}
+}
+
+func TestRecordAnswerTwice(t *testing.T) {
+	useTestDatabase(t)
+	addTestQuiz(t, "journey", "Journey", arithmeticQuestions)
+	server := newTestServer(t)
+	contestantId := createContestant("journey", "Rita", "legal")
+
+	if status := postAnswer(t, server.URL, contestantId, 1, 2); status != http.StatusOK {
+		t.Fatalf("got status %d, want 200", status)
+	}
+	if status := postAnswer(t, server.URL, contestantId, 1, 2); status != http.StatusConflict {
+		t.Errorf("answering again got status %d, want 409", status)
+	}
+	details := getContestantDetails(context.Background(), contestantId)
+	if details.CorrectAnswers != 1 || details.QuestionsAnswered != 1 || countAnswers(t, contestantId) != 1 {
+		t.Errorf("got %+v with %d answers, want the first answer counted once", details, countAnswers(t, contestantId))
+	}
+}
+
+func TestRecordAnswerAfterFinishing(t *testing.T) {
+	useTestDatabase(t)
+	addTestQuiz(t, "journey", "Journey", arithmeticQuestions)
+	server := newTestServer(t)
+	contestantId := createContestant("journey", "Rita", "legal")
+
+	for question, answer := range []int{2, 2, 1} {
+		if status := postAnswer(t, server.URL, contestantId, question+1, answer); status != http.StatusOK {
+			t.Fatalf("question %d: got status %d, want 200", question+1, status)
+		}
+	}
+	for question := 1; question <= 4; question++ {
+		if status := postAnswer(t, server.URL, contestantId, question, 1); status != http.StatusConflict {
+			t.Errorf("question %d after finishing: got status %d, want 409", question, status)
+		}
+	}
+	if details := getContestantDetails(context.Background(), contestantId); details.CorrectAnswers != 3 || countAnswers(t, contestantId) != 3 {
+		t.Errorf("got %+v with %d answers, want the 3 from the quiz", details, countAnswers(t, contestantId))
+	}
+}
+
+func TestRecordAnswerNotShown(t *testing.T) {
+	useTestDatabase(t)
+	addTestQuiz(t, "journey", "Journey", arithmeticQuestions)
+	if err := updateQuiz("journey", map[string]interface{}{"fifty_fifty": 1}); err != nil {
+		t.Fatal(err)
+	}
+	server := newTestServer(t)
+	contestantId := createContestant("journey", "Rita", "legal")
+
+	if status := postAnswer(t, server.URL, contestantId, 1, 7); status != http.StatusBadRequest {
+		t.Errorf("answer 7: got status %d, want 400", status)
+	}
+
+	status, _, body := postForm(t, newTestClient(t), server.URL+"/fifty-fifty/", url.Values{"question": {"1"}, "contestant-id": {contestantId}}, true)
+	if status != http.StatusOK {
+		t.Fatalf("50/50: got status %d: %s", status, body)
+	}
+	details := getContestantDetails(context.Background(), contestantId)
+	quizDetails, _ := getQuiz("journey")
+	_, question := getQuestionDetails("journey", details, 1)
+	offered := question
+	applyPowerups(quizDetails, details, &offered)
+	var removed []int
+	for _, answer := range question.Answers {
+		if !answerOffered(offered, answer.Number) {
+			removed = append(removed, answer.Number)
+		}
+	}
+	if len(removed) != 2 {
+		t.Fatalf("50/50 removed %v, want two answers", removed)
+	}
+
+	for _, answer := range removed {
+		if status := postAnswer(t, server.URL, contestantId, 1, answer); status != http.StatusBadRequest {
+			t.Errorf("answer %d removed by the 50/50: got status %d, want 400", answer, status)
+		}
+	}
+	if count := countAnswers(t, contestantId); count != 0 {
+		t.Errorf("got %d answers recorded, want none", count)
+	}
+	if status := postAnswer(t, server.URL, contestantId, 1, 2); status != http.StatusOK {
+		t.Errorf("the correct answer: got status %d, want 200", status)
+	}
+}
+
+func TestRecordAnswerInTimedRoundNeverShown(t *testing.T) {
+	useTestDatabase(t)
+	addTestQuiz(t, "journey", "Journey", roundQuestions)
+	rounds, err := listRounds("journey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := updateRound(rounds[0].RoundId, map[string]interface{}{"time_limit_seconds": 60}); err != nil {
+		t.Fatal(err)
+	}
+	server := newTestServer(t)
+
+	// posting straight to the first question skips the round intro, and with it the timer
+	skipped := createContestant("journey", "Rita", "legal")
+	if status := postAnswer(t, server.URL, skipped, 1, 2); status != http.StatusOK {
+		t.Fatalf("got status %d, want the answer recorded", status)
+	}
+	if details := getContestantDetails(context.Background(), skipped); details.CorrectAnswers != 0 {
+		t.Errorf("got %d correct answers without the round being shown, want none", details.CorrectAnswers)
+	}
+
+	// as the quiz page does when it shows the round's first question
+	shown := createContestant("journey", "Sam", "legal")
+	if err := startRound(shown, rounds[0].RoundId); err != nil {
+		t.Fatal(err)
+	}
+	if status := postAnswer(t, server.URL, shown, 1, 2); status != http.StatusOK {
+		t.Fatalf("got status %d, want the answer recorded", status)
+	}
+	if details := getContestantDetails(context.Background(), shown); details.CorrectAnswers != 1 {
+		t.Errorf("got %d correct answers within the time, want 1", details.CorrectAnswers)
+	}
+}
+
+func TestReloadingDoesNotRestartTheAnswerClock(t *testing.T) {
+	useTestDatabase(t)
+	addTestQuiz(t, "journey", "Journey", arithmeticQuestions)
+	server := newTestServer(t)
+	player := testPlayer{t: t, client: newTestClient(t), server: server.URL, htmx: true}
+	if status, _, _ := postForm(t, player.client, server.URL+"/journey/legal", url.Values{"contestant-name": {"Rita"}}, false); status != http.StatusFound {
+		t.Fatalf("registering: got status %d", status)
+	}
+	contestantId := generateContestantId("Rita", "journey", "legal")
+
+	player.page("/quiz/journey/")
+	// the question was shown a while ago, then the contestant looks up the answer and reloads
+	if _, err := makeDatabaseQuery("UPDATE scores SET question_served = DATETIME('now', '-30 seconds') WHERE contestant_id = ?", contestantId); err != nil {
+		t.Fatal(err)
+	}
+	player.page("/quiz/journey/")
+
+	if status := postAnswer(t, server.URL, contestantId, 1, 2); status != http.StatusOK {
+		t.Fatalf("got status %d, want 200", status)
+	}
+	rows, err := makeDatabaseQuery("SELECT time_taken_seconds FROM answers WHERE contestant_id = ?", contestantId)
+	if err != nil || len(rows) != 1 {
+		t.Fatalf("got %d answers (%v)", len(rows), err)
+	}
+	if seconds := rows[0]["time_taken_seconds"].(float64); seconds < 29 {
+		t.Errorf("took %.1f seconds, want the time since the question was first shown", seconds)
+	}
+}
+
+func TestQuizPageOnlyShowsTheNextQuestion(t *testing.T) {
+	useTestDatabase(t)
+	addTestQuiz(t, "journey", "Journey", roundQuestions)
+	if err := updateQuiz("journey", map[string]interface{}{"jokers": 1}); err != nil {
+		t.Fatal(err)
+	}
+	server := newTestServer(t)
+	contestantId := createContestant("journey", "Rita", "legal")
+
+	// asking for the finale before answering anything would show it early and start its timer
+	for _, question := range []string{"1", "2", "-1"} {
+		status, _, body := postForm(t, newTestClient(t), server.URL+"/quiz/journey/",
+			url.Values{"question": {question}, "contestant-id": {contestantId}, "round-intro": {"seen"}, "joker": {"round"}}, true)
+		if status != http.StatusConflict {
+			t.Errorf("question after %s: got status %d, want 409: %s", question, status, body)
+		}
+	}
+	for _, table := range []string{"contestant_rounds", "contestant_powerups"} {
+		rows, err := makeDatabaseQuery("SELECT COUNT(*) AS found FROM "+table+" WHERE contestant_id = ?", contestantId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found := rows[0]["found"].(int64); found != 0 {
+			t.Errorf("got %d rows in %s, want none", found, table)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"time"
+)
+
+type requestIdKey struct{}
+
+// request IDs passed in by a proxy are kept if they look like one, so logs can be matched up with the proxy's
+var validRequestId = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// sends the server's logs through slog, including anything still written with the log package
+func setupLogging(format string, level string) error {
+	var logLevel slog.Level
+	if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("log level must be debug, info, warn or error, got %q", level)
+	}
+	options := &slog.HandlerOptions{Level: logLevel}
+
+	switch format {
+	case "text":
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, options)))
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, options)))
+	default:
+		return fmt.Errorf("log format must be text or json, got %q", format)
+	}
+	return nil
+}
+
+func newRequestId() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// gives each request an ID, returned in the X-Request-Id header and added to everything logged while handling it
+func withRequestId(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestId := r.Header.Get("X-Request-Id")
+		if !validRequestId.MatchString(requestId) {
+			requestId = newRequestId()
+		}
+		w.Header().Set("X-Request-Id", requestId)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIdKey{}, requestId)))
+	})
+}
+
+// the logger for work done on behalf of a request, or the default logger outside of one
+func contextLogger(ctx context.Context) *slog.Logger {
+	if requestId, ok := ctx.Value(requestIdKey{}).(string); ok {
+		return slog.Default().With("request_id", requestId)
+	}
+	return slog.Default()
+}
+
+func requestLogger(r *http.Request) *slog.Logger {
+	return contextLogger(r.Context())
+}
+
+// remembers the status and size of a response for the access log
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	if recorder.status == 0 {
+		recorder.status = status
+	}
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+func (recorder *statusRecorder) Write(b []byte) (int, error) {
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+	n, err := recorder.ResponseWriter.Write(b)
+	recorder.bytes += n
+	return n, err
+}
+
+func (recorder *statusRecorder) Flush() {
+	if flusher, ok := recorder.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (recorder *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := recorder.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response can't be hijacked")
+	}
+	return hijacker.Hijack()
+}
+
+// logs every request once it has been handled and records its latency against the route it matched, e.g.
+// "POST /record-answer/{$}", so the metrics don't grow with every quiz and group
+func accessLog(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+		recorder := &statusRecorder{ResponseWriter: w}
+		mux.ServeHTTP(recorder, r)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+
+		elapsed := time.Since(start)
+		metrics.observeRequest(route, recorder.status, elapsed)
+		requestLogger(r).Info("request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"route", route,
+			"status", recorder.status,
+			"bytes", recorder.bytes,
+			"duration_ms", float64(elapsed.Microseconds())/1000,
+			"remote_addr", r.RemoteAddr,
+		)
+	})
+}
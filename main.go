@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/md5"
 	"database/sql"
 	"encoding/base64"
@@ -8,8 +9,10 @@ import (
 	"fmt"
 	"html/template"
 	"log"
+	"log/slog"
 	"math/rand"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -23,19 +26,40 @@ type Answer struct {
 }
 
 type Question struct {
+	QuestionId     int64
 	Order          int64
 	QuestionText   string
 	Answers        []Answer
 	CorrectAnswer  int64
 	TotalQuestions int64
+	Points         float64
+	Round          Round
+	RoundNumber    int
+	TotalRounds    int
+	FirstInRound   bool
+	SecondsLeft    int64
+	Timed          bool
 }
 
 type Score struct {
-	ContestantId   string
-	ContestantName string
-	Group          string
-	CorrectAnswers int64
-	TimeTaken      string
+	ContestantId   string  `json:"contestant_id"`
+	ContestantName string  `json:"name"`
+	Group          string  `json:"group"`
+	CorrectAnswers int64   `json:"correct_answers"`
+	TotalQuestions int64   `json:"total_questions"`
+	Points         float64 `json:"points"`
+	// taken off the points by an admin reviewing the score, already included in Points
+	Penalty          float64      `json:"penalty,omitempty"`
+	MaxPoints        float64      `json:"max_points"`
+	Percent          float64      `json:"percent"`
+	TimeTaken        string       `json:"time_taken"`
+	TimeTakenSeconds int64        `json:"time_taken_seconds"`
+	Estimate         *float64     `json:"estimate,omitempty"`
+	Rounds           []RoundScore `json:"rounds,omitempty"`
+	JokerPlayed      bool         `json:"joker_played"`
+	FiftyFiftyPlayed bool         `json:"fifty_fifty_played"`
+
+	lastAnswerSeconds float64
 }
 
 type Contestant struct {
@@ -47,28 +71,37 @@ type Contestant struct {
 	Finished          string
 	CorrectAnswers    int64
 	QuestionsAnswered int64
+	Seed              int64
 }
 
 type Quiz struct {
-	quizId string
-	Name   string
+	quizId            string
+	Name              string
+	ShuffleQuestions  bool
+	ShuffleAnswers    bool
+	SampleSize        int64
+	SampleStratify    string
+	NegativeMarking   float64
+	SpeedBonus        float64
+	SpeedBonusSeconds int64
+	StreakBonus       float64
+	TieBreaker        string
+	EstimateQuestion  string
+	EstimateAnswer    float64
+	Jokers            bool
+	FiftyFifty        bool
+	// empty to pick the language from the contestant's browser
+	Locale string
+	// report contestants leaving the page and flag answers that are too quick for review
+	IntegrityChecks bool
+	// 0 for no limit on the contestants in each group
+	MaxGroupSize int64
+	// registering needs the browser to solve a small puzzle first, so it needs JavaScript
+	ProofOfWork bool
 }
 
-var CorrectAnswerText = []string{
-	"Well done, you're smarter than you look",
-	"Come on, that was a lucky guess wasn't it? I won't tell anyone...",
-	"Way to go",
-	"Your knowledge is impressive",
-	"Even Santa couldn't answer that one!",
-}
-
-var IncorrectAnswerText = []string{
-	"Better luck with the next one",
-	"Rudolph could have answered it",
-	"You may get replaced by ChatGPT at this rate...",
-	"How did you not know that?!?",
-	"You've made the elves cry",
-}
+// can be overridden with the -db flag or QUIZ_DATABASE environment variable
+var databasePath = "./data/quiz-data.db"
 
 func generateContestantId(name string, quiz string, group string) string {
 	input := fmt.Sprintf("%s-%s-%s", name, strings.ToLower(quiz), strings.ToLower(group))
@@ -79,43 +112,37 @@ func generateContestantId(name string, quiz string, group string) string {
 	return urlSafeHash
 }
 
-func getQuizDetails(urlPath string, urlType string) (extractedQuidId string, groupName string) {
-	var quidId string
-	var group string
-	parts := strings.Split(urlPath, "/")
-
-	if len(parts) >= 3 {
-		if urlType == "question" {
-			quidId = parts[2]
-			group = ""
-		} else if urlType == "scoreboard" {
-			quidId = parts[2]
-			group = parts[3]
-		} else if urlType == "referrer" {
-			quidId = parts[3]
-			group = parts[4]
-		} else {
-			quidId = parts[1]
-			group = parts[2]
-		}
-		return quidId, group
-	}
-
-	return
+func openDatabase() (*sql.DB, error) {
+	return sql.Open("sqlite3", databasePath)
 }
 
 func makeDatabaseQuery(query string, args ...interface{}) ([]map[string]interface{}, error) {
-	db, err := sql.Open("sqlite3", "./data/quiz-data.db")
+	return makeDatabaseQueryContext(context.Background(), query, args...)
+}
+
+// the context only carries the request ID for the logs, queries aren't cancelled with the request so an answer is never
+// left half saved
+func makeDatabaseQueryContext(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	logger := contextLogger(ctx)
+	db, err := openDatabase()
 	if err != nil {
-		log.Panicln("error connecting to database", err.Error())
-		return nil, err
+		logger.Error("error connecting to database", "error", err)
+		panic(err)
 	}
 	defer db.Close()
 
+	operation := queryOperation(query)
+	start := time.Now()
+	defer func() {
+		elapsed := time.Since(start)
+		metrics.observeQuery(operation, elapsed, err)
+		logger.Debug("query", "operation", operation, "duration_ms", float64(elapsed.Microseconds())/1000)
+	}()
+
 	rows, err := db.Query(query, args...)
 	if err != nil {
-		log.Panicln("error in query", err.Error())
-		return nil, err
+		logger.Error("error in query", "operation", operation, "error", err)
+		panic(err)
 	}
 	defer rows.Close()
 
@@ -152,57 +179,175 @@ func makeDatabaseQuery(query string, args ...interface{}) ([]map[string]interfac
 	return result, nil
 }
 
-func getQuestionDetails(quizId string, questionNumber string) (string, Question) {
-	var quizTitle string = ""
+// returns the quiz title and the question shown to the contestant at the given position (starting at 1) of the set of
+// questions assigned to them
+func getQuestionDetails(quizId string, contestant Contestant, position int) (string, Question) {
 	var retrievedQuestion Question
 
-	questionQuery := `SELECT *, quizzes.name, 
-		(SELECT COUNT(*) FROM questions WHERE questions.quiz_id = ? AND active = 1) AS total_questions
-		FROM questions 
-		LEFT JOIN quizzes ON quizzes.quiz_id = questions.quiz_id
-		WHERE questions.quiz_id = ?
-		AND questions.sort_order >= ?
-		AND questions.active = 1`
+	quizDetails, err := getQuiz(quizId)
+	if err != nil {
+		slog.Error("Error getting quiz details", "error", err)
+		return "", retrievedQuestion
+	}
+
+	questionIds, err := getQuestionOrder(quizDetails, contestant)
+	if err != nil {
+		slog.Error("Error getting question order", "quiz_id", quizId, "error", err)
+		return quizDetails.Name, retrievedQuestion
+	}
+	if position < 1 || position > len(questionIds) {
+		return quizDetails.Name, retrievedQuestion
+	}
+
+	questionQuery := "SELECT * FROM questions WHERE question_id = ?"
+	result, err := makeDatabaseQuery(questionQuery, questionIds[position-1])
+	if err != nil {
+		slog.Error("Error getting question details", "error", err)
+		return quizDetails.Name, retrievedQuestion
+	}
 
-	result, err := makeDatabaseQuery(questionQuery, quizId, quizId, questionNumber)
+	questionRounds, err := getQuestionRounds(quizId)
 	if err != nil {
-		log.Fatal("Error getting quiz details", err.Error())
+		slog.Error("Error getting rounds", "quiz_id", quizId, "error", err)
 	}
 
 	if len(result) > 0 {
-		quizTitle = result[0]["name"].(string)
 		retrievedQuestion = Question{
-			Order:        result[0]["sort_order"].(int64),
-			QuestionText: result[0]["question"].(string),
-			Answers: []Answer{
-				{
-					Number: 1,
-					Text:   result[0]["answer_1"].(string),
-				},
-				{
-					Number: 2,
-					Text:   result[0]["answer_2"].(string),
-				},
-				{
-					Number: 3,
-					Text:   result[0]["answer_3"].(string),
-				},
-				{
-					Number: 4,
-					Text:   result[0]["answer_4"].(string),
-				},
-			},
+			QuestionId:     result[0]["question_id"].(int64),
+			Order:          int64(position),
+			QuestionText:   result[0]["question"].(string),
 			CorrectAnswer:  result[0]["correct_answer"].(int64),
-			TotalQuestions: result[0]["total_questions"].(int64),
+			TotalQuestions: int64(len(questionIds)),
+			Round:          questionRounds[questionIds[position-1]],
+		}
+
+		// rounds are numbered by the ones this contestant actually gets questions from
+		var previousRound int64
+		for i, questionId := range questionIds {
+			roundId := questionRounds[questionId].RoundId
+			if roundId != 0 && (i == 0 || roundId != previousRound) {
+				retrievedQuestion.TotalRounds++
+				if i < position {
+					retrievedQuestion.RoundNumber = retrievedQuestion.TotalRounds
+				}
+			}
+			if i == position-1 {
+				retrievedQuestion.FirstInRound = roundId != 0 && (i == 0 || roundId != previousRound)
+			}
+			previousRound = roundId
+		}
+		// questions outside a round score as normal
+		if retrievedQuestion.Round.RoundId == 0 {
+			retrievedQuestion.Round.Multiplier = 1
+		}
+
+		// questions taken out of the quiz since the contestant was given them are worth the default point
+		retrievedQuestion.Points = 1
+		pointsResult, err := makeDatabaseQuery("SELECT points FROM quiz_questions WHERE quiz_id = ? AND question_id = ?", quizId, retrievedQuestion.QuestionId)
+		if err != nil {
+			slog.Error("Error getting question points", "error", err)
+		} else if len(pointsResult) > 0 {
+			retrievedQuestion.Points = pointsResult[0]["points"].(float64)
+		}
+		for number := 1; number <= 4; number++ {
+			text, _ := result[0][fmt.Sprintf("answer_%d", number)].(string)
+			retrievedQuestion.Answers = append(retrievedQuestion.Answers, Answer{
+				Number: number,
+				Text:   text,
+			})
 		}
+
+		// answers keep their canonical number so grading is unaffected, only the display order changes
+		if quizDetails.ShuffleAnswers {
+			shuffler := rand.New(rand.NewSource(contestant.Seed ^ retrievedQuestion.QuestionId))
+			shuffler.Shuffle(len(retrievedQuestion.Answers), func(i, j int) {
+				retrievedQuestion.Answers[i], retrievedQuestion.Answers[j] = retrievedQuestion.Answers[j], retrievedQuestion.Answers[i]
+			})
+		}
+	}
+
+	return quizDetails.Name, retrievedQuestion
+}
+
+func getQuiz(quizId string) (Quiz, error) {
+	var quizDetails Quiz
+
+	result, err := makeDatabaseQuery(`SELECT quiz_id, name, shuffle_questions, shuffle_answers, sample_size, sample_stratify,
+		negative_marking, speed_bonus, speed_bonus_seconds, streak_bonus, tie_breaker, estimate_question, estimate_answer,
+		jokers, fifty_fifty, locale, integrity_checks, max_group_size, proof_of_work
+		FROM quizzes WHERE quiz_id = ?`, quizId)
+	if err != nil {
+		return quizDetails, err
+	}
+	if len(result) == 0 {
+		return quizDetails, fmt.Errorf("no quiz found with ID %s", quizId)
 	}
 
-	return quizTitle, retrievedQuestion
+	quizDetails.quizId = result[0]["quiz_id"].(string)
+	quizDetails.Name = result[0]["name"].(string)
+	quizDetails.ShuffleQuestions = result[0]["shuffle_questions"].(int64) == 1
+	quizDetails.ShuffleAnswers = result[0]["shuffle_answers"].(int64) == 1
+	quizDetails.SampleSize = result[0]["sample_size"].(int64)
+	quizDetails.SampleStratify = result[0]["sample_stratify"].(string)
+	quizDetails.NegativeMarking = result[0]["negative_marking"].(float64)
+	quizDetails.SpeedBonus = result[0]["speed_bonus"].(float64)
+	quizDetails.SpeedBonusSeconds = result[0]["speed_bonus_seconds"].(int64)
+	quizDetails.StreakBonus = result[0]["streak_bonus"].(float64)
+	quizDetails.TieBreaker = result[0]["tie_breaker"].(string)
+	quizDetails.EstimateQuestion = result[0]["estimate_question"].(string)
+	quizDetails.EstimateAnswer = result[0]["estimate_answer"].(float64)
+	quizDetails.Jokers = result[0]["jokers"].(int64) == 1
+	quizDetails.FiftyFifty = result[0]["fifty_fifty"].(int64) == 1
+	quizDetails.Locale = result[0]["locale"].(string)
+	quizDetails.IntegrityChecks = result[0]["integrity_checks"].(int64) == 1
+	quizDetails.MaxGroupSize = result[0]["max_group_size"].(int64)
+	quizDetails.ProofOfWork = result[0]["proof_of_work"].(int64) == 1
+
+	return quizDetails, nil
+}
+
+// question IDs in the order the contestant sees them. The first time this is called for a contestant the questions are
+// sampled (if the quiz uses a pool) and shuffled using their seed, then saved so later changes to the quiz don't move them
+func getQuestionOrder(quizDetails Quiz, contestant Contestant) ([]int64, error) {
+	if contestant.ContestantId != "" {
+		assigned, err := getAssignedQuestions(contestant.ContestantId)
+		if err != nil || len(assigned) > 0 {
+			return assigned, err
+		}
+	}
+
+	pool, err := getQuestionPool(quizDetails)
+	if err != nil {
+		return nil, err
+	}
+
+	shuffler := rand.New(rand.NewSource(contestant.Seed))
+	questionIds := sampleQuestions(pool, int(quizDetails.SampleSize), shuffler)
+
+	questionRounds, err := getQuestionRounds(quizDetails.quizId)
+	if err != nil {
+		return nil, err
+	}
+	if len(questionRounds) > 0 {
+		orderByRound(questionIds, questionRounds, quizDetails.ShuffleQuestions, shuffler)
+	} else if quizDetails.ShuffleQuestions {
+		shuffler.Shuffle(len(questionIds), func(i, j int) {
+			questionIds[i], questionIds[j] = questionIds[j], questionIds[i]
+		})
+	}
+
+	if contestant.ContestantId != "" && len(questionIds) > 0 {
+		if err := saveAssignedQuestions(contestant.ContestantId, questionIds); err != nil {
+			return nil, err
+		}
+	}
+
+	return questionIds, nil
 }
 
 func insertContestant(quizId string, contestantName string, group string) string {
 
-	db, err := sql.Open("sqlite3", "./data/quiz-data.db")
+	db, err := openDatabase()
 	if err != nil {
 		log.Fatal("error connecting to database", err.Error())
 		return ""
@@ -210,9 +355,9 @@ func insertContestant(quizId string, contestantName string, group string) string
 	defer db.Close()
 
 	generatedContestantId := generateContestantId(contestantName, quizId, group)
-	insertQuery := "INSERT INTO scores(quiz_id, `group`, name, correct_answers, questions_answered, contestant_id) VALUES (?, ?, ?, 0, 0, ?)"
+	insertQuery := "INSERT INTO scores(quiz_id, `group`, name, correct_answers, questions_answered, contestant_id, shuffle_seed) VALUES (?, ?, ?, 0, 0, ?, ?)"
 
-	_, insertErr := db.Exec(insertQuery, quizId, strings.ToLower(group), contestantName, generatedContestantId)
+	_, insertErr := db.Exec(insertQuery, quizId, strings.ToLower(group), contestantName, generatedContestantId, rand.Int63())
 	if insertErr != nil {
 		log.Panicln("error in query", err.Error())
 		return ""
@@ -248,11 +393,11 @@ func createContestant(quizId string, contestantName string, group string) string
 	return contestantId
 }
 
-func getContestantDetails(contestantId string) Contestant {
+func getContestantDetails(ctx context.Context, contestantId string) Contestant {
 	var contestantDetails Contestant
 
 	contestantQuery := "SELECT * FROM scores WHERE contestant_id = ?"
-	contestantResult, err := makeDatabaseQuery(contestantQuery, contestantId)
+	contestantResult, err := makeDatabaseQueryContext(ctx, contestantQuery, contestantId)
 	if err != nil {
 		log.Panicln("Error retrieving contestant details", err.Error())
 	}
@@ -267,19 +412,22 @@ func getContestantDetails(contestantId string) Contestant {
 			contestantDetails.Started = contestantResult[0]["started"].(string)
 		}
 		if contestantResult[0]["finished"] == nil {
-			contestantDetails.Started = ""
+			contestantDetails.Finished = ""
 		} else {
 			contestantDetails.Finished = contestantResult[0]["finished"].(string)
 		}
 		contestantDetails.QuizId = contestantResult[0]["quiz_id"].(string)
 		contestantDetails.CorrectAnswers = contestantResult[0]["correct_answers"].(int64)
 		contestantDetails.QuestionsAnswered = contestantResult[0]["questions_answered"].(int64)
+		if seed, ok := contestantResult[0]["shuffle_seed"].(int64); ok {
+			contestantDetails.Seed = seed
+		}
 	}
 
 	return contestantDetails
 }
 
-func updateContestant(contestantId string, setStarted bool, correctAnswer bool) bool {
+func updateContestant(ctx context.Context, contestantId string, setStarted bool, correctAnswer bool) bool {
 
 	updateQuery := "UPDATE scores SET questions_answered = questions_answered + 1 WHERE contestant_id = ?"
 	if setStarted {
@@ -288,7 +436,7 @@ func updateContestant(contestantId string, setStarted bool, correctAnswer bool)
 	if correctAnswer {
 		updateQuery = "UPDATE scores SET correct_answers = correct_answers + 1, questions_answered = questions_answered + 1 WHERE contestant_id = ?"
 	}
-	updateResult, updateErr := makeDatabaseQuery(updateQuery, contestantId)
+	updateResult, updateErr := makeDatabaseQueryContext(ctx, updateQuery, contestantId)
 	if updateErr != nil {
 		log.Fatalln("Error updating score for", contestantId, updateErr.Error())
 	}
@@ -300,6 +448,105 @@ func updateContestant(contestantId string, setStarted bool, correctAnswer bool)
 	return true
 }
 
+// moves the contestant on from the question at position, counting it if they got it right. False if they had already
+// moved on, so an answer posted twice at once is only counted once
+func advanceContestant(ctx context.Context, contestantId string, position int, correct bool) (bool, error) {
+	correctValue := 0
+	if correct {
+		correctValue = 1
+	}
+
+	db, err := openDatabase()
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	result, err := db.ExecContext(ctx, `UPDATE scores SET questions_answered = ?, correct_answers = correct_answers + ?
+		WHERE contestant_id = ? AND questions_answered = ? AND finished IS NULL`, position, correctValue, contestantId, position-1)
+	if err != nil {
+		return false, err
+	}
+	updated, err := result.RowsAffected()
+	return updated == 1, err
+}
+
+// true if the answer is one of the question's, as shown to the contestant
+func answerOffered(question Question, selectedAnswer int) bool {
+	for _, answer := range question.Answers {
+		if answer.Number == selectedAnswer && answer.Text != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// the line shown under an answered question, with one of the quiz's feedback messages when it wasn't a timeout
+func answerGradeText(quizId string, translator Translator, correct bool, timeUp bool) string {
+	if timeUp {
+		return translator.Text("grade.time_up")
+	}
+	if correct {
+		return translator.Text("grade.correct") + " " + randomFeedback(quizId, feedbackCorrect, translator)
+	}
+	return translator.Text("grade.incorrect") + " " + randomFeedback(quizId, feedbackIncorrect, translator)
+}
+
+// shows a question once it has been answered, with the contestant's answer and the correct one marked and a button on
+// to the next question. htmx gets the question to swap in and plain requests the whole quiz page
+func writeAnsweredQuestion(w http.ResponseWriter, r *http.Request, contestantDetails Contestant, position int, selectedAnswer int, correct bool, timeUp bool) {
+	quizTitle, retrievedQuestion := getQuestionDetails(contestantDetails.QuizId, contestantDetails, position)
+	translator := requestTranslator(r, contestantDetails.QuizId)
+	retrievedQuestion = translateQuestion(retrievedQuestion, translator.Locale)
+
+	quizDetails, err := getQuiz(contestantDetails.QuizId)
+	if err != nil {
+		requestLogger(r).Error("Error getting quiz details", "error", err)
+	}
+	powerups := applyPowerups(quizDetails, contestantDetails, &retrievedQuestion)
+
+	// quizzes that break ties on an estimate ask for it with the last answer
+	var estimateQuestion string
+	if position == int(retrievedQuestion.TotalQuestions) && quizDetails.TieBreaker == "estimate" {
+		estimateQuestion = quizDetails.EstimateQuestion
+	}
+
+	page, templateName := "quiz", "base"
+	if isHtmxRequest(r) {
+		page, templateName = "question", "question"
+	}
+	tmpl, err := pageTemplates.get(page)
+	if err != nil {
+		requestLogger(r).Error("Error rendering template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	templateValues := map[string]interface{}{
+		"QuizTitle":        quizTitle,
+		"QuizId":           publicQuizId(contestantDetails.QuizId),
+		"Theme":            requestTheme(r, contestantDetails.QuizId),
+		"OrgPath":          requestOrganisation(r).BasePath,
+		"Group":            contestantDetails.Group,
+		"Question":         retrievedQuestion,
+		"Contestant":       contestantDetails.ContestantId,
+		"Answer":           true,
+		"Selected":         selectedAnswer,
+		"Correct":          correct,
+		"GradeText":        answerGradeText(contestantDetails.QuizId, translator, correct, timeUp),
+		"T":                translator,
+		"EstimateQuestion": estimateQuestion,
+		"Powerups":         powerups,
+		"IntegrityChecks":  quizDetails.IntegrityChecks,
+	}
+
+	err = tmpl.ExecuteTemplate(w, templateName, templateValues)
+	if err != nil {
+		requestLogger(r).Error("Error rendering template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
 func secondsToDurationString(durationInSeconds int64) string {
 	duration := time.Second * time.Duration(durationInSeconds)
 
@@ -311,18 +558,88 @@ func secondsToDurationString(durationInSeconds int64) string {
 }
 
 func getGroupScores(quizId string, group string) []Score {
-	groupScoreQuery := `SELECT contestant_id, name, correct_answers, 
+	// contestants drawing from a pool may get different numbers of questions and questions can be worth different
+	// points, so the scorer ranks on the share of the points available to each contestant that they got
+	groupScoreQuery := `SELECT contestant_id, name, correct_answers, total_questions, max_points, estimate, penalty,
 		(strftime('%s', finished) - strftime('%s', started)) AS time_taken_seconds
-		FROM scores
+		FROM (SELECT *, COALESCE(NULLIF((SELECT COUNT(*) FROM contestant_questions WHERE contestant_questions.contestant_id = scores.contestant_id), 0),
+			(SELECT COUNT(*) FROM quiz_questions WHERE quiz_questions.quiz_id = scores.quiz_id AND active = 1)) AS total_questions,
+			COALESCE((SELECT SUM(COALESCE(quiz_questions.points, 1.0) * COALESCE(rounds.multiplier, 1.0)) FROM contestant_questions
+				LEFT JOIN quiz_questions ON quiz_questions.quiz_id = scores.quiz_id AND quiz_questions.question_id = contestant_questions.question_id
+				LEFT JOIN rounds ON rounds.round_id = quiz_questions.round_id
+				WHERE contestant_questions.contestant_id = scores.contestant_id),
+			(SELECT SUM(quiz_questions.points * COALESCE(rounds.multiplier, 1.0)) FROM quiz_questions
+				LEFT JOIN rounds ON rounds.round_id = quiz_questions.round_id
+				WHERE quiz_questions.quiz_id = scores.quiz_id AND active = 1), 0.0) AS max_points
+			FROM scores)
 		WHERE quiz_id = ?
 		AND "group" = ?
-		AND finished IS NOT NULL 
-		ORDER BY correct_answers DESC, (strftime('%s', finished) - strftime('%s', started)) ASC`
+		AND finished IS NOT NULL
+		AND disqualified = 0`
 	groupScoreResult, err := makeDatabaseQuery(groupScoreQuery, quizId, group)
 	if err != nil {
 		log.Fatalln("Error getting scores", err.Error())
 	}
 
+	// only the first answer a contestant gives to a question counts
+	answersQuery := `SELECT answers.contestant_id, answers.question_id, answers.round_id, answers.correct, answers.points, answers.time_taken_seconds
+		FROM answers
+		INNER JOIN scores ON scores.contestant_id = answers.contestant_id
+		WHERE answers.quiz_id = ? AND scores."group" = ?
+		AND answers.answer_id = (SELECT MIN(first.answer_id) FROM answers AS first WHERE first.contestant_id = answers.contestant_id AND first.question_id = answers.question_id)
+		ORDER BY answers.answer_id`
+	answersResult, err := makeDatabaseQuery(answersQuery, quizId, group)
+	if err != nil {
+		log.Fatalln("Error getting answers", err.Error())
+	}
+
+	powerupsQuery := `SELECT contestant_powerups.contestant_id, powerup, question_id, round_id
+		FROM contestant_powerups
+		INNER JOIN scores ON scores.contestant_id = contestant_powerups.contestant_id
+		WHERE scores.quiz_id = ? AND scores."group" = ?`
+	powerupsResult, err := makeDatabaseQuery(powerupsQuery, quizId, group)
+	if err != nil {
+		log.Fatalln("Error getting power-ups", err.Error())
+	}
+	powerups := map[string]map[string]playedPowerup{}
+	for _, row := range powerupsResult {
+		contestantId := row["contestant_id"].(string)
+		if powerups[contestantId] == nil {
+			powerups[contestantId] = map[string]playedPowerup{}
+		}
+		var played playedPowerup
+		played.questionId, _ = row["question_id"].(int64)
+		played.roundId, _ = row["round_id"].(int64)
+		powerups[contestantId][row["powerup"].(string)] = played
+	}
+
+	answers := map[string][]scoredAnswer{}
+	for _, row := range answersResult {
+		answer := scoredAnswer{
+			questionId: row["question_id"].(int64),
+			correct:    row["correct"].(int64) == 1,
+			points:     row["points"].(float64),
+		}
+		answer.roundId, _ = row["round_id"].(int64)
+		answer.timeTaken, answer.timed = row["time_taken_seconds"].(float64)
+		contestantId := row["contestant_id"].(string)
+		if joker, played := powerups[contestantId][jokerPowerup]; played {
+			answer.joker = joker.questionId == answer.questionId || (joker.roundId != 0 && joker.roundId == answer.roundId)
+		}
+		answers[contestantId] = append(answers[contestantId], answer)
+	}
+
+	quizDetails, err := getQuiz(quizId)
+	if err != nil {
+		slog.Error("Error getting quiz details", "error", err)
+	}
+	scorer := newScorer(quizDetails)
+
+	rounds, err := listRounds(quizId)
+	if err != nil {
+		slog.Error("Error getting rounds", "quiz_id", quizId, "error", err)
+	}
+
 	var scores []Score
 
 	for _, row := range groupScoreResult {
@@ -337,11 +654,25 @@ func getGroupScores(quizId string, group string) []Score {
 			ContestantName: row["name"].(string),
 			Group:          group,
 			CorrectAnswers: row["correct_answers"].(int64),
+			TotalQuestions: row["total_questions"].(int64),
+			MaxPoints:      row["max_points"].(float64),
+			Penalty:        row["penalty"].(float64),
 			TimeTaken:      formattedTimeTaken,
 		}
+		thisScore.TimeTakenSeconds, _ = timeTaken.(int64)
+		if estimate, ok := row["estimate"].(float64); ok {
+			thisScore.Estimate = &estimate
+		}
+
+		_, thisScore.JokerPlayed = powerups[thisScore.ContestantId][jokerPowerup]
+		_, thisScore.FiftyFiftyPlayed = powerups[thisScore.ContestantId][fiftyFiftyPowerup]
+
+		scorer.score(&thisScore, answers[thisScore.ContestantId], rounds)
 		scores = append(scores, thisScore)
 	}
 
+	scorer.rank(scores)
+
 	return scores
 }
 
@@ -349,7 +680,7 @@ func getGroupScores(quizId string, group string) []Score {
 func createQuiz(quizId string, quizName string) (*Quiz, bool) {
 	var QuizDetails Quiz
 
-	db, err := sql.Open("sqlite3", "./data/quiz-data.db")
+	db, err := openDatabase()
 	if err != nil {
 		log.Fatal("error connecting to database", err.Error())
 		return nil, false
@@ -377,8 +708,8 @@ func createQuiz(quizId string, quizName string) (*Quiz, bool) {
 		rowCount++
 	} else {
 		// no existing details found
-		createQuiz := "INSERT INTO quizzes(quiz_id, name) VALUES(?, ?)"
-		_, createErr := db.Exec(createQuiz, quizId, quizName)
+		createQuiz := "INSERT INTO quizzes(quiz_id, name, org_id) VALUES(?, ?, ?)"
+		_, createErr := db.Exec(createQuiz, quizId, quizName, quizOrganisation(quizId))
 		if createErr != nil {
 			log.Panicln("Error in insert query", err.Error())
 			return nil, false
@@ -396,29 +727,110 @@ func createQuiz(quizId string, quizName string) (*Quiz, bool) {
 	return &QuizDetails, true
 }
 
-func main() {
+// adds a question to the bank and returns the new question ID, use addQuestionToQuiz to include it in a quiz
+func insertQuestion(question BankQuestion) (int64, error) {
+	if len(question.Answers) != 4 {
+		return 0, fmt.Errorf("expected 4 answers, got %d", len(question.Answers))
+	}
+
+	db, err := openDatabase()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	orgId := question.OrgId
+	if orgId == "" {
+		orgId = defaultOrganisation
+	}
+
+	insertQuery := `INSERT INTO questions(question, answer_1, answer_2, answer_3, answer_4, correct_answer, category, difficulty, author, org_id) 
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	insertResult, err := db.Exec(insertQuery, question.QuestionText, question.Answers[0], question.Answers[1], question.Answers[2], question.Answers[3],
+		question.CorrectAnswer, question.Category, question.Difficulty, question.Author, orgId)
+	if err != nil {
+		return 0, err
+	}
+
+	questionId, err := insertResult.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return questionId, setQuestionTags(questionId, question.Tags)
+}
+
+// the web server's routes with all their middleware, everything serve needs apart from listening
+func newHandler(dev bool) (http.Handler, error) {
+	assets, err := loadStaticAssets()
+	if err != nil {
+		return nil, err
+	}
+	staticAssets = assets
+
+	if _, err := loadCatalogs(); err != nil {
+		return nil, err
+	}
+
+	templates, err := newTemplateRegistry(dev)
+	if err != nil {
+		return nil, err
+	}
+	pageTemplates = templates
 
 	home := func(w http.ResponseWriter, r *http.Request) {
 
 		existingContestant := false
+		org := requestOrganisation(r)
 
-		if r.Method == "POST" {
+		// contestants can only register while the quiz is open for their group
+		scheduleQuizId, scheduleGroup := requestQuiz(r)
+		schedule, err := getSchedule(scheduleQuizId, scheduleGroup)
+		if err != nil {
+			requestLogger(r).Error("Error getting schedule", "quiz_id", scheduleQuizId, "error", err)
+		}
+		now := time.Now().UTC()
+
+		quizId, group := requestQuiz(r)
+		quizTitle := "Not Found"
+		var quizDetails Quiz
+
+		if quizId != "" {
+			quizDetails, err = getQuiz(quizId)
+			if err != nil {
+				requestLogger(r).Error("Error getting quiz details", "quiz_id", quizId, "error", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			quizTitle = quizDetails.Name
+		}
+
+		var contestantName string
+		var problem registrationProblem
+		if r.Method == "POST" && schedule.Open(now) {
 			// create new contestant
 
-			quizId, group := getQuizDetails(r.URL.Path, "initial")
-			contestantName := r.PostFormValue("contestant-name")
-			contestantId := createContestant(quizId, contestantName, group)
+			contestantName, problem, err = checkRegistration(r, quizDetails, group, now)
+			if err != nil {
+				requestLogger(r).Error("Error checking registration", "quiz_id", quizId, "error", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+
+			if problem == "" {
+				contestantId := createContestant(quizId, contestantName, group)
 
-			if contestantId != "" {
-				// if the person was created/retrieved successfully redirect to the first question
-				cookie := http.Cookie{
-					Name:  "contestant-id",
-					Value: contestantId,
-					Path:  "/",
+				if contestantId != "" {
+					// if the person was created/retrieved successfully redirect to the first question
+					cookie := http.Cookie{
+						Name:  "contestant-id",
+						Value: contestantId,
+						Path:  "/",
+					}
+					http.SetCookie(w, &cookie)
+					http.Redirect(w, r, fmt.Sprintf("%s/quiz/%s/", org.BasePath, publicQuizId(quizId)), http.StatusFound)
+					return
 				}
-				http.SetCookie(w, &cookie)
-				http.Redirect(w, r, fmt.Sprintf("/quiz/%s/", quizId), http.StatusFound)
-			} else {
 				// if we found an existing record, update the value so we show the message in the template
 				existingContestant = true
 			}
@@ -427,36 +839,40 @@ func main() {
 
 		// initial render or error creating contestant
 
-		quizId, group := getQuizDetails(r.URL.Path, "initial")
-		quizTitle := "Not Found"
-
-		if quizId != "" {
-			quizDetails := "SELECT name FROM quizzes WHERE quiz_id = ?"
-			result, err := makeDatabaseQuery(quizDetails, quizId)
-			if err != nil {
-				log.Fatal("Error getting quiz details", err)
-			}
-			if len(result) > 0 {
-				quizTitle = result[0]["name"].(string)
-			}
+		var challenge string
+		if quizDetails.ProofOfWork {
+			challenge = newProofOfWorkChallenge(quizId, group, now)
 		}
 
-		tmpl, err := template.ParseFiles("./templates/base.html", "./templates/home.html")
+		tmpl, err := pageTemplates.get("home")
 		if err != nil {
-			log.Fatalln("Error rendering template", err.Error())
+			requestLogger(r).Error("Error rendering template", "error", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
 		err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
 			"QuizTitle":       quizTitle,
-			"QuizId":          quizId,
+			"QuizId":          publicQuizId(quizId),
+			"Theme":           requestTheme(r, quizId),
+			"T":               requestTranslator(r, quizId),
+			"OrgPath":         org.BasePath,
 			"Group":           group,
 			"ExistingMessage": existingContestant,
+			"Problem":         string(problem),
+			"ContestantName":  contestantName,
+			"MaxNameLength":   maxContestantNameLength,
+			"HoneypotField":   honeypotField,
+			"Challenge":       challenge,
+			"ProofOfWorkBits": proofOfWorkBits,
+			"NotOpenYet":      schedule.NotOpenYet(now),
+			"Closed":          schedule.Closed(now),
+			"OpensAt":         schedule.OpensAt,
+			"ClosesAt":        schedule.ClosesAt,
+			"SecondsToOpen":   int64(schedule.OpensAt.Sub(now).Seconds()),
 		})
 		if err != nil {
-			log.Fatalln(err.Error())
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			requestLogger(r).Error("Error rendering template", "error", err)
 		}
 
 	}
@@ -468,158 +884,281 @@ func main() {
 		quizStarted := false
 		currentQuestion := r.PostFormValue("question")
 		// for the first question the created contestant ID should be set in the cookie
-		cookie, err := r.Cookie("contestant-id")
-		if err != nil {
-			log.Fatalln("Error reading cookie")
+		if cookie, err := r.Cookie("contestant-id"); err == nil {
+			contestantId = cookie.Value
 		}
-		contestantId = cookie.Value
 		if contestantId == "" {
 			// for all subsequent questions it should be in the form values
 			contestantId = r.PostFormValue("contestant-id")
 		}
-		quizId, _ := getQuizDetails(r.URL.Path, "question")
+		org := requestOrganisation(r)
+		quizId, _ := requestQuiz(r)
+		if contestantId == "" {
+			// nobody to play as, e.g. cookies are blocked or expired, so send them to register
+			http.Redirect(w, r, org.BasePath+"/"+publicQuizId(quizId)+"/", http.StatusSeeOther)
+			return
+		}
+
+		contestantDetails := getContestantDetails(r.Context(), contestantId)
+		if !quizInRequestOrganisation(r, contestantDetails.QuizId) {
+			http.NotFound(w, r)
+			return
+		}
+		scoreboardUrl := fmt.Sprintf("%s/scoreboard/%s/%s/?c=%s", org.BasePath, publicQuizId(quizId), contestantDetails.Group, contestantId)
+		if !quizOpenFor(contestantDetails) {
+			if len(currentQuestion) > 0 {
+				writeQuizClosed(w, r, quizId, contestantDetails.Group)
+			} else {
+				http.Redirect(w, r, scoreboardUrl, http.StatusFound)
+			}
+			return
+		}
+
+		// plain form posts answering a question are redirected here to show it answered
+		if answered, _ := strconv.Atoi(r.URL.Query().Get("answered")); r.Method == http.MethodGet && answered > 0 && answered == int(contestantDetails.QuestionsAnswered) {
+			_, retrievedQuestion := getQuestionDetails(quizId, contestantDetails, answered)
+			selectedAnswer, correct, found, err := getAnswer(r.Context(), contestantId, retrievedQuestion.QuestionId)
+			if err != nil {
+				requestLogger(r).Error("Error getting answer", "contestant_id", contestantId, "error", err)
+			}
+			if found {
+				writeAnsweredQuestion(w, r, contestantDetails, answered, selectedAnswer, correct, !correct && r.URL.Query().Get("grade") == "time_up")
+				return
+			}
+		}
 
-		contestantDetails := getContestantDetails(contestantId)
 		if len(currentQuestion) > 0 {
-			// add one to get the next question
+			// add one to get the next question, only once they have answered this one so nobody can look ahead
 			convertedNum, _ := strconv.Atoi(currentQuestion)
+			if convertedNum != int(contestantDetails.QuestionsAnswered) {
+				http.Error(w, "That isn't the question you are on", http.StatusConflict)
+				return
+			}
 			questionNum = convertedNum + 1
 			quizStarted = true
+		} else if contestantDetails.Finished != "" {
+			http.Redirect(w, r, scoreboardUrl, http.StatusFound)
+			return
+		} else if contestantDetails.QuestionsAnswered > 0 {
+			// coming back part way through, carry on from the next unanswered question
+			questionNum = int(contestantDetails.QuestionsAnswered) + 1
 		}
 
 		var quizTitle string
 		var retrievedQuestion Question
 
 		if quizId != "" {
-			quizTitle, retrievedQuestion = getQuestionDetails(quizId, strconv.Itoa(questionNum))
+			quizTitle, retrievedQuestion = getQuestionDetails(quizId, contestantDetails, questionNum)
 		}
+		translator := requestTranslator(r, quizId)
+		retrievedQuestion = translateQuestion(retrievedQuestion, translator.Locale)
+
+		// the first question of each round is shown after the round's intro screen
+		showRoundIntro := retrievedQuestion.FirstInRound && r.FormValue("round-intro") == ""
 
-		templatesToRender := []string{
-			"./templates/base.html",
-			"./templates/quiz.html",
-			"./templates/question.html",
+		quizDetails, err := getQuiz(quizId)
+		if err != nil {
+			requestLogger(r).Error("Error getting quiz details", "error", err)
+		}
+		if r.PostFormValue("joker") == "round" && retrievedQuestion.FirstInRound && !showRoundIntro {
+			if _, err := playJoker(quizDetails, contestantId, 0, retrievedQuestion.Round.RoundId); err != nil {
+				requestLogger(r).Info("Joker not played", "contestant_id", contestantId, "error", err)
+			}
 		}
 
-		// if this isn't the first question we only need the question element rendered
-		if questionNum != 1 || quizStarted {
-			templatesToRender = []string{
-				"./templates/question.html",
+		// without htmx the next question is shown by redirecting to the quiz page, which carries on from it
+		if quizStarted && !isHtmxRequest(r) {
+			nextUrl := quizPageUrl(r, quizId)
+			if !showRoundIntro && retrievedQuestion.FirstInRound {
+				nextUrl += "?round-intro=seen"
 			}
-		} else {
-			updateSucceeded := updateContestant(contestantId, true, false)
+			http.Redirect(w, r, nextUrl, http.StatusSeeOther)
+			return
+		}
+		powerups := applyPowerups(quizDetails, contestantDetails, &retrievedQuestion)
+
+		// note when the question was first shown so we can work out how long it took to answer, reloading it doesn't
+		// restart the clock
+		if retrievedQuestion.QuestionId != 0 && !showRoundIntro {
+			_, err := makeDatabaseQuery(`UPDATE scores SET question_served = STRFTIME('%Y-%m-%d %H:%M:%f', 'now'), served_position = ?
+				WHERE contestant_id = ? AND served_position IS NOT ?`, questionNum, contestantId, questionNum)
+			if err != nil {
+				requestLogger(r).Error("Error setting question served time", "contestant_id", contestantId, "error", err)
+			}
+
+			if retrievedQuestion.Round.RoundId != 0 {
+				if err := startRound(contestantId, retrievedQuestion.Round.RoundId); err != nil {
+					requestLogger(r).Error("Error starting round", "contestant_id", contestantId, "error", err)
+				}
+				retrievedQuestion.SecondsLeft, retrievedQuestion.Timed, err = roundSecondsLeft(contestantId, retrievedQuestion.Round)
+				if err != nil {
+					requestLogger(r).Error("Error getting round timer", "contestant_id", contestantId, "error", err)
+				}
+			}
+		}
+
+		templatesToRender := "quiz"
+
+		// if this isn't the first question we only need the question element rendered
+		if quizStarted {
+			templatesToRender = "question"
+		} else if contestantDetails.QuestionsAnswered == 0 {
+			updateSucceeded := updateContestant(r.Context(), contestantId, true, false)
 			if !updateSucceeded {
-				log.Fatalln("Error when setting started datetime")
+				requestLogger(r).Error("Error when setting started datetime", "contestant_id", contestantId)
 			}
 		}
 
-		tmpl, err := template.ParseFiles(templatesToRender...)
+		tmpl, err := pageTemplates.get(templatesToRender)
 		if err != nil {
-			log.Fatalln("Error rendering template", err.Error())
+			requestLogger(r).Error("Error rendering template", "error", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
 		templateValues := map[string]interface{}{
 			"QuizTitle":  quizTitle,
-			"QuizId":     quizId,
+			"QuizId":     publicQuizId(quizId),
+			"Theme":      requestTheme(r, quizId),
+			"T":          translator,
+			"OrgPath":    org.BasePath,
 			"Question":   retrievedQuestion,
 			"Contestant": contestantId,
 			"Group":      contestantDetails.Group,
+			"RoundIntro": showRoundIntro,
+			"Powerups":   powerups,
+			// only used by the whole page, the fragments are swapped into it
+			"IntegrityChecks": quizDetails.IntegrityChecks,
+			// the intro's start button asks for the question after this one, i.e. the first in the round
+			"PreviousQuestion": questionNum - 1,
 		}
 
-		if questionNum != 1 || quizStarted {
+		if quizStarted && showRoundIntro {
+			err = tmpl.ExecuteTemplate(w, "round-intro", templateValues)
+		} else if quizStarted {
 			err = tmpl.ExecuteTemplate(w, "question", templateValues)
 		} else {
 			err = tmpl.ExecuteTemplate(w, "base", templateValues)
 		}
 		if err != nil {
-			log.Fatalln(err.Error())
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			requestLogger(r).Error("Error rendering template", "error", err)
 		}
 
 	}
 
 	recordAnswer := func(w http.ResponseWriter, r *http.Request) {
 		// get the submitted form details
-		var gradeText string
-		// Generate a random number between 0 and 5
-		randomNumber := rand.Intn(5)
 		questionAnswered := r.PostFormValue("question")
 		questionAnsweredInt, _ := strconv.Atoi(questionAnswered)
 		contestantId := r.PostFormValue("contestant-id")
-		contestantDetails := getContestantDetails(contestantId)
+		contestantDetails := getContestantDetails(r.Context(), contestantId)
+		if !quizInRequestOrganisation(r, contestantDetails.QuizId) {
+			http.NotFound(w, r)
+			return
+		}
+		if !quizOpenFor(contestantDetails) {
+			writeQuizClosed(w, r, contestantDetails.QuizId, contestantDetails.Group)
+			return
+		}
 		selectedAnswer := r.PostFormValue("answers")
 		selectedAnswerInt, err := strconv.Atoi(selectedAnswer)
 		if err != nil {
-			log.Panicln("Error converting answer string to int", err.Error())
+			http.Error(w, "Choose an answer", http.StatusBadRequest)
+			return
+		}
+		// only the question they are on can be answered, once
+		if contestantDetails.Finished != "" {
+			http.Error(w, "You have already finished the quiz", http.StatusConflict)
+			return
+		}
+		if questionAnsweredInt != int(contestantDetails.QuestionsAnswered)+1 {
+			http.Error(w, "That isn't the question you are on", http.StatusConflict)
+			return
 		}
-		if err == nil {
-			// check if this is the correct answer
-			var retrievedQuestion Question
-			_, retrievedQuestion = getQuestionDetails(contestantDetails.QuizId, questionAnswered)
 
-			if retrievedQuestion.CorrectAnswer != 0 {
+		var retrievedQuestion Question
+		_, retrievedQuestion = getQuestionDetails(contestantDetails.QuizId, contestantDetails, questionAnsweredInt)
+		if retrievedQuestion.CorrectAnswer == 0 {
+			http.Error(w, "Question not found", http.StatusBadRequest)
+			return
+		}
 
-				if selectedAnswerInt == int(retrievedQuestion.CorrectAnswer) {
-					// update the score if this is the correct answer
-					gradeText = fmt.Sprintf("Correct! %s", CorrectAnswerText[randomNumber])
-					updateSucceeded := updateContestant(contestantId, false, true)
-					if !updateSucceeded {
-						log.Fatalln("Error when updating answer totals for", contestantId)
-					}
-				} else {
-					gradeText = fmt.Sprintf("Incorrect! %s", IncorrectAnswerText[randomNumber])
-					updateSucceeded := updateContestant(contestantId, false, false)
-					if !updateSucceeded {
-						log.Fatalln("Error when updating answer totals for", contestantId)
-					}
-				}
+		quizDetails, err := getQuiz(contestantDetails.QuizId)
+		if err != nil {
+			requestLogger(r).Error("Error getting quiz details", "error", err)
+		}
+		// the answer has to be one they were shown, not an empty slot or one taken away by their 50/50
+		offered := retrievedQuestion
+		applyPowerups(quizDetails, contestantDetails, &offered)
+		if !answerOffered(offered, selectedAnswerInt) {
+			http.Error(w, "Choose one of the answers shown", http.StatusBadRequest)
+			return
+		}
 
-				// if this is the last question, set the finish time
-				if questionAnsweredInt == int(retrievedQuestion.TotalQuestions) {
-					finishQuery := "UPDATE scores SET finished = DATETIME('now') WHERE contestant_id = ?"
-					_, err := makeDatabaseQuery(finishQuery, contestantId)
-					if err != nil {
-						log.Fatalln("Error setting finish time for", contestantId, err.Error())
-					}
-				}
+		if r.PostFormValue("joker") == "question" {
+			if _, err := playJoker(quizDetails, contestantId, retrievedQuestion.QuestionId, 0); err != nil {
+				requestLogger(r).Info("Joker not played", "contestant_id", contestantId, "error", err)
+			}
+		}
 
-				// return the answer
-				// include a next button to move to the next one
-				tmpl, err := template.ParseFiles("./templates/question.html")
-				if err != nil {
-					log.Fatalln("Error rendering template", err.Error())
-					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-					return
-				}
+		// once a round's timer has run out answers are still recorded but don't score
+		secondsLeft, timed, err := roundSecondsLeft(contestantId, retrievedQuestion.Round)
+		if err != nil {
+			requestLogger(r).Error("Error getting round timer", "contestant_id", contestantId, "error", err)
+		}
+		timeUp := timed && secondsLeft < -roundGraceSeconds
+		correct := selectedAnswerInt == int(retrievedQuestion.CorrectAnswer) && !timeUp
 
-				templateValues := map[string]interface{}{
-					"QuizId":     contestantDetails.QuizId,
-					"Question":   retrievedQuestion,
-					"Contestant": contestantId,
-					"Answer":     true,
-					"GradeText":  template.HTML(gradeText),
-				}
+		// a second post of the same answer, e.g. a double click, loses here so it isn't counted twice
+		advanced, err := advanceContestant(r.Context(), contestantId, questionAnsweredInt, correct)
+		if err != nil {
+			requestLogger(r).Error("Error when updating answer totals", "contestant_id", contestantId, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !advanced {
+			http.Error(w, "That question has already been answered", http.StatusConflict)
+			return
+		}
 
-				err = tmpl.ExecuteTemplate(w, "question", templateValues)
-				if err != nil {
-					log.Fatalln("Error rendering template", err.Error())
-					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-				}
+		err = saveAnswer(r.Context(), contestantDetails, retrievedQuestion, selectedAnswerInt, correct)
+		if err != nil {
+			requestLogger(r).Error("Error saving answer", "contestant_id", contestantId, "error", err)
+		}
+
+		// if this is the last question, set the finish time
+		if questionAnsweredInt == int(retrievedQuestion.TotalQuestions) {
+			finishQuery := "UPDATE scores SET finished = DATETIME('now') WHERE contestant_id = ?"
+			_, err := makeDatabaseQuery(finishQuery, contestantId)
+			if err != nil {
+				requestLogger(r).Error("Error setting finish time", "contestant_id", contestantId, "error", err)
 			}
 		}
+
+		// without htmx redirect to the answered question so refreshing the page doesn't post the answer again
+		if !isHtmxRequest(r) {
+			answeredUrl := fmt.Sprintf("%s?answered=%d", quizPageUrl(r, contestantDetails.QuizId), questionAnsweredInt)
+			if timeUp {
+				answeredUrl += "&grade=time_up"
+			}
+			http.Redirect(w, r, answeredUrl, http.StatusSeeOther)
+			return
+		}
+		writeAnsweredQuestion(w, r, contestantDetails, questionAnsweredInt, selectedAnswerInt, correct, timeUp)
 	}
 
 	scoreboard := func(w http.ResponseWriter, r *http.Request) {
-		quizId, urlGroup := getQuizDetails(r.URL.Path, "scoreboard")
+		quizId, urlGroup := requestQuiz(r)
 		quizTitle := "Not Found"
 		totalQuestions := int64(0)
 
 		if quizId != "" {
-			quizDetails := "SELECT name, (SELECT COUNT(*) FROM questions WHERE quiz_id = ? AND active = 1) AS total_questions FROM quizzes WHERE quiz_id = ?"
+			quizDetails := "SELECT name, (SELECT COUNT(*) FROM quiz_questions WHERE quiz_id = ? AND active = 1) AS total_questions FROM quizzes WHERE quiz_id = ?"
 			result, err := makeDatabaseQuery(quizDetails, quizId, quizId)
 			if err != nil {
-				log.Fatalln("Error getting quiz details", err)
+				requestLogger(r).Error("Error getting quiz details", "quiz_id", quizId, "error", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
 			}
 			if len(result) > 0 {
 				quizTitle = result[0]["name"].(string)
@@ -638,20 +1177,37 @@ func main() {
 				contestantId = r.PostFormValue("contestant-id")
 			}
 		}
+		// contestants from other organisations are treated as unknown
+		if contestantId != "" && !quizInRequestOrganisation(r, getContestantDetails(r.Context(), contestantId).QuizId) {
+			contestantId = ""
+		}
 
 		var groupScores []Score
-		templatesToRender := []string{
-			"./templates/base.html",
-			"./templates/scoreboard.html",
-		}
 		showError := true
 
+		// the estimate for the tie breaker is sent with the last answer and can't be changed afterwards
+		if estimate, err := strconv.ParseFloat(r.PostFormValue("estimate"), 64); err == nil && contestantId != "" {
+			_, err := makeDatabaseQuery("UPDATE scores SET estimate = ? WHERE contestant_id = ? AND finished IS NOT NULL AND estimate IS NULL", estimate, contestantId)
+			if err != nil {
+				requestLogger(r).Error("Error saving estimate", "contestant_id", contestantId, "error", err)
+			}
+		}
+
 		var contestantDetails Contestant
 		if contestantId != "" {
-			contestantDetails = getContestantDetails(contestantId)
+			contestantDetails = getContestantDetails(r.Context(), contestantId)
 			// get all scores for the group, sort by points and total time
 			groupScores = getGroupScores(quizId, contestantDetails.Group)
 			showError = false
+
+			// when questions are drawn from a pool the contestant's own total may be lower than the quiz total
+			assigned, err := getAssignedQuestions(contestantId)
+			if err != nil {
+				requestLogger(r).Error("Error getting assigned questions", "contestant_id", contestantId, "error", err)
+			}
+			if len(assigned) > 0 {
+				totalQuestions = int64(len(assigned))
+			}
 		}
 
 		if contestantId == "" && urlGroup != "" {
@@ -659,151 +1215,222 @@ func main() {
 			showError = false
 		}
 
-		tmpl, err := template.ParseFiles(templatesToRender...)
+		tmpl, err := pageTemplates.get("scoreboard")
 		if err != nil {
-			log.Fatalln("Error rendering template", err.Error())
+			requestLogger(r).Error("Error rendering template", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		quizDetails, _ := getQuiz(quizId)
+		rounds, err := listRounds(quizId)
+		if err != nil {
+			requestLogger(r).Error("Error getting rounds", "quiz_id", quizId, "error", err)
+		}
+
+		// once the group's quiz has closed nobody else can finish, so the scores are final
+		scheduleGroup := urlGroup
+		if contestantDetails.Group != "" {
+			scheduleGroup = contestantDetails.Group
+		}
+		schedule, err := getSchedule(quizId, scheduleGroup)
+		if err != nil {
+			requestLogger(r).Error("Error getting schedule", "quiz_id", quizId, "error", err)
+		}
+
+		// only show points when the scoring rules make them different to the number of correct answers
+		showPoints := len(rounds) > 0
+		for _, score := range groupScores {
+			if score.Points != float64(score.CorrectAnswers) {
+				showPoints = true
+			}
 		}
 
 		err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
 			"QuizTitle":      quizTitle,
+			"Theme":          requestTheme(r, quizId),
+			"T":              requestTranslator(r, quizId),
 			"TotalQuestions": totalQuestions,
+			"Sampled":        quizDetails.SampleSize > 0,
+			"Rounds":         rounds,
+			"ShowPoints":     showPoints,
+			"Final":          schedule.Closed(time.Now().UTC()),
 			"Scores":         groupScores,
 			"Contestant":     contestantDetails,
 			"ShowError":      showError,
 		})
 		if err != nil {
-			log.Fatalln("Error rendering template", err.Error())
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			requestLogger(r).Error("Error rendering template", "error", err)
 		}
 	}
 
 	createQuestion := func(w http.ResponseWriter, r *http.Request) {
 
-		okayToShow := false
-		isAdmin := false
-
-		// not a good way to protect this but enough to prevent a casual person stumbling across the page
-		if r.Method == "GET" && r.URL.RawQuery != "" {
-			q := r.URL.Query()
-			adminQueryValue := q.Get("admin")
-			if adminQueryValue == "true" {
-				isAdmin = true
-			}
-		}
-
 		if r.Method == "POST" {
-			adminFormValue := r.PostFormValue("admin")
-			if adminFormValue == "ihavethepower" {
-				isAdmin = true
-			}
-		}
+			var errorText string
 
-		if !strings.Contains(r.Host, "127.0.0.1") && !isAdmin {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		} else {
-			okayToShow = true
-		}
+			quizName := r.PostFormValue("quiz_name")
 
-		if okayToShow {
-			if r.Method == "POST" {
-				var errorText string
+			// the quiz is optional, without one the question only goes into the bank
+			quizId := r.PostFormValue("quiz_id")
+			if quizId != "" && validateQuizId(quizId) != nil {
+				errorText = `<p class="error">Quiz IDs can only use letters, numbers, dots, dashes and underscores</p>`
+			}
+			quizId = scopedQuizId(requestOrganisation(r).OrgId, quizId)
 
-				quizName := r.PostFormValue("quiz_name")
+			sort_order := r.PostFormValue("sort_order")
+			if quizId != "" && sort_order == "" {
+				errorText = `<p class="error">Missing sort order, this is required when adding to a quiz</p>`
+			}
 
-				quizId := r.PostFormValue("quiz_id")
-				if quizId == "" {
-					errorText = `<p class="error">Missing quiz ID, this is required</p>`
-				}
+			question := r.PostFormValue("question")
+			if question == "" || len(question) < 10 {
+				errorText = `<p class="error">Missing question text or question text too short, this is required</p>`
+			}
 
-				sort_order := r.PostFormValue("sort_order")
-				if sort_order == "" {
-					errorText = `<p class="error">Missing sort order, this is required</p>`
-				}
+			answers := []string{r.PostFormValue("answer_1"), r.PostFormValue("answer_2"), r.PostFormValue("answer_3"), r.PostFormValue("answer_4")}
+			correct_answer := r.PostFormValue("correct_answer")
+			correctAnswerInt, _ := strconv.ParseInt(correct_answer, 10, 64)
+			if correct_answer == "" {
+				errorText = `<p class="error">Missing correct answer, this is required</p>`
+			} else if validateCorrectAnswer(correct_answer, answers) != nil {
+				errorText = `<p class="error">The correct answer must be one of the four answers and can't be left empty</p>`
+			}
 
-				question := r.PostFormValue("question")
-				if question == "" || len(question) < 10 {
-					errorText = `<p class="error">Missing question text or question text too short, this is required</p>`
-				}
+			difficulty := r.PostFormValue("difficulty")
+			if validateDifficulty(difficulty) != nil {
+				errorText = `<p class="error">Unknown difficulty</p>`
+			}
 
-				correct_answer := r.PostFormValue("correct_answer")
-				if correct_answer == "" {
-					errorText = `<p class="error">Missing correct answer, this is required</p>`
+			if errorText != "" {
+				requestLogger(r).Warn("Error detected", "detail", errorText)
+				tmpl := template.Must(template.New("error").Parse(errorText))
+				tmpl.Execute(w, "error")
+			} else {
+				success := true
+				if quizId != "" {
+					_, success = createQuiz(quizId, quizName)
 				}
-
-				if errorText != "" {
-					log.Fatalln("Error detected", errorText)
-					tmpl, err := template.New("error").Parse(errorText)
-					if err != nil {
-						log.Fatalln("Error rendering template", err.Error())
+				if success {
+
+					questionId, insertErr := insertQuestion(BankQuestion{
+						QuestionText:  question,
+						Answers:       answers,
+						CorrectAnswer: correctAnswerInt,
+						Category:      strings.TrimSpace(r.PostFormValue("category")),
+						Difficulty:    difficulty,
+						Author:        strings.TrimSpace(r.PostFormValue("author")),
+						Tags:          parseTags(r.PostFormValue("tags")),
+						OrgId:         requestOrganisation(r).OrgId,
+					})
+					if insertErr == nil && quizId != "" {
+						insertErr = addQuestionToQuiz(quizId, questionId, sort_order)
 					}
-					tmpl.Execute(w, "error")
-				} else {
-					answer_1 := r.PostFormValue("answer_1")
-					answer_2 := r.PostFormValue("answer_2")
-					answer_3 := r.PostFormValue("answer_3")
-					answer_4 := r.PostFormValue("answer_4")
-
-					quizDetails, success := createQuiz(quizId, quizName)
-					if success {
-
-						db, err := sql.Open("sqlite3", "./data/quiz-data.db")
-						if err != nil {
-							log.Fatalln("error connecting to database", err.Error())
-						}
-						defer db.Close()
-
-						insertQuery := `INSERT INTO questions(quiz_id, sort_order, question, answer_1, answer_2, answer_3, answer_4, correct_answer, active) 
-							VALUES(?, ?, ?, ?, ?, ?, ?, ?, 1)`
-						insertResult, err := db.Exec(insertQuery, quizDetails.quizId, sort_order, question, answer_1, answer_2, answer_3, answer_4, correct_answer)
-						if err != nil {
-							log.Fatalln("Error in query", err.Error())
-							tmpl, err := template.New("error").Parse(`<p class="error">There was a problem inserting the question</p>`)
-							if err != nil {
-								log.Fatalln("Error rendering template", err.Error())
-							}
-							tmpl.Execute(w, "error")
-						}
-						_, insertErr := insertResult.LastInsertId()
-						if insertErr == nil {
-							tmpl, err := template.New("success").Parse(`<p class="green">Question added successfully</p>`)
-							if err != nil {
-								log.Fatalln("Error rendering template", err.Error())
-							}
-							tmpl.Execute(w, "success")
-						}
+					if insertErr != nil {
+						requestLogger(r).Error("Error in query", "error", insertErr)
+						tmpl := template.Must(template.New("error").Parse(`<p class="error">There was a problem inserting the question</p>`))
+						tmpl.Execute(w, "error")
 					} else {
-						log.Fatalln("Error getting/creating quiz details")
+						recordWebAudit(r, "question add", quizId, fmt.Sprintf("question %d", questionId))
+						tmpl := template.Must(template.New("success").Parse(`<p class="green">Question added successfully</p>`))
+						tmpl.Execute(w, "success")
 					}
-				}
-			} else {
-
-				templatesToRender := []string{
-					"./templates/base.html",
-					"./templates/question-add.html",
-				}
-
-				tmpl, err := template.ParseFiles(templatesToRender...)
-				if err != nil {
-					log.Fatalln("Error rendering template", err.Error())
-				}
-
-				err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{"isAdmin": isAdmin})
-				if err != nil {
-					log.Fatalln("Error rendering template", err.Error())
+				} else {
+					requestLogger(r).Error("Error getting/creating quiz details", "quiz_id", quizId)
 					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				}
+			}
+		} else {
 
+			tmpl, err := pageTemplates.get("question-add")
+			if err != nil {
+				requestLogger(r).Error("Error rendering template", "error", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+
+			admin, loggedIn := requestAdmin(r)
+			err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+				"OrgPath":   requestOrganisation(r).BasePath,
+				"CanBackup": loggedIn && admin.isServerOwner(),
+			})
+			if err != nil {
+				requestLogger(r).Error("Error rendering template", "error", err)
 			}
+
 		}
 	}
 
-	http.HandleFunc("/quiz/", quiz)
-	http.HandleFunc("/record-answer/", recordAnswer)
-	http.HandleFunc("/scoreboard/", scoreboard)
-	http.HandleFunc("/create-question/", createQuestion)
-	http.HandleFunc("/", home)
+	// each handler gets its own limiters so a new one, e.g. in the tests, starts with full buckets
+	limitRegistrations := rateLimited(limiterFor("registrations", rateLimits.RegistrationsPerMinute, rateLimits.RegistrationsPerMinute), clientIp)
+	limitRequests := rateLimited(limiterFor("requests", rateLimits.RequestsPerMinute, rateLimits.RequestsPerMinute), clientIp)
+	limitContestant := rateLimited(limiterFor("contestant", rateLimits.ContestantRequestsPerMinute, contestantBurst), requestContestantId)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /static/{file}", staticHandler)
+	mux.HandleFunc("GET /{quiz}/{$}", chain(home, knownQuiz))
+	mux.HandleFunc("POST /{quiz}/{$}", chain(home, limitRegistrations, knownQuiz))
+	mux.HandleFunc("GET /{quiz}/{group}", chain(home, knownQuiz))
+	mux.HandleFunc("POST /{quiz}/{group}", chain(home, limitRegistrations, knownQuiz))
+	// htmx posts the next question to /quiz/{quiz} without the trailing slash
+	mux.HandleFunc("GET /quiz/{quiz}/{$}", chain(quiz, knownQuiz))
+	mux.HandleFunc("POST /quiz/{quiz}/{$}", chain(quiz, limitRequests, limitContestant, knownQuiz))
+	mux.HandleFunc("POST /quiz/{quiz}", chain(quiz, limitRequests, limitContestant, knownQuiz))
+	mux.HandleFunc("POST /record-answer/{$}", chain(recordAnswer, limitRequests, limitContestant))
+	mux.HandleFunc("POST /fifty-fifty/{$}", chain(fiftyFifty, limitRequests, limitContestant))
+	mux.HandleFunc("POST /integrity/{$}", chain(integrityReportHandler, limitRequests, limitContestant))
+	// contestants who joined without a group are sent to the quiz's scoreboard with their contestant ID
+	mux.HandleFunc("GET /scoreboard/{quiz}/{$}", chain(scoreboard, knownQuiz))
+	mux.HandleFunc("POST /scoreboard/{quiz}/{$}", chain(scoreboard, knownQuiz))
+	mux.HandleFunc("GET /scoreboard/{quiz}/{group}/{$}", chain(scoreboard, knownQuiz, knownGroup))
+	mux.HandleFunc("POST /scoreboard/{quiz}/{group}/{$}", chain(scoreboard, knownQuiz, knownGroup))
+	mux.HandleFunc("GET /create-question/{$}", chain(createQuestion, requirePermission(permissionEditQuestions, quizFromForm)))
+	mux.HandleFunc("POST /create-question/{$}", chain(createQuestion, requirePermission(permissionEditQuestions, quizFromForm)))
+	mux.HandleFunc("GET /question-bank/{$}", chain(questionBank, requirePermission(permissionEditQuestions, quizFromForm)))
+	mux.HandleFunc("POST /question-bank/{$}", chain(questionBank, requirePermission(permissionEditQuestions, quizFromForm)))
+	mux.HandleFunc("GET /export/{quiz}/{$}", chain(exportResults, requirePermission(permissionViewResults, quizFromPath), knownQuiz))
+	mux.HandleFunc("GET /theme/{quiz}/theme.css", chain(themeStylesheetHandler, knownQuiz))
+	mux.HandleFunc("GET /theme/{quiz}/{$}", chain(themeHandler, requirePermission(permissionEditQuestions, quizFromPath), knownQuiz))
+	mux.HandleFunc("POST /theme/{quiz}/{$}", chain(themeHandler, requirePermission(permissionEditQuestions, quizFromPath), knownQuiz))
+	mux.HandleFunc("GET /analytics/{quiz}/{$}", chain(quizAnalytics, requirePermission(permissionViewResults, quizFromPath), knownQuiz))
+	mux.HandleFunc("POST /reset-group/{quiz}/{$}", chain(resetGroupHandler, requirePermission(permissionManageGroups, quizFromPath), knownQuiz))
+	mux.HandleFunc("GET /review/{quiz}/{$}", chain(reviewHandler, requirePermission(permissionManageGroups, quizFromPath), knownQuiz))
+	mux.HandleFunc("POST /review/{quiz}/{$}", chain(reviewHandler, requirePermission(permissionManageGroups, quizFromPath), knownQuiz))
+	mux.HandleFunc("POST /backup/{$}", chain(backupDownloadHandler, requireServerOwner))
+
+	metricsToken = os.Getenv("METRICS_TOKEN")
+	mux.HandleFunc("GET /metrics", metricsHandler)
+
+	// health checks skip the organisation lookup and access log, they're hit every few seconds
+	root := http.NewServeMux()
+	root.HandleFunc("GET /healthz", healthzHandler)
+	root.HandleFunc("GET /readyz", readyzHandler)
+	root.Handle("/", withOrganisation(accessLog(mux)))
+
+	return securityHeaders(withRequestId(root)), nil
+}
+
+func serve(port string, dev bool) error {
+	handler, err := newHandler(dev)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+	slog.Info("Starting server", "port", port)
+	return listenAndServe(server)
+}
 
-	port := "8001"
-	fmt.Println("Starting server on port", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+func main() {
+	if err := runCommand(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err.Error())
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMain(m *testing.M) {
+	// handlers log every request, only show it when the tests are run with -v
+	flag.Parse()
+	if !testing.Verbose() {
+		slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	}
+	os.Exit(m.Run())
+}
+
+// a copy of the static files with one more added
+func withStaticFile(files fs.FS, name string, content string) fs.FS {
+	copied := fstest.MapFS{name: {Data: []byte(content)}}
+	fs.WalkDir(files, ".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(files, path)
+		copied[path] = &fstest.MapFile{Data: data}
+		return err
+	})
+	return copied
+}
+
+func TestLoadStaticAssetsNeedsHtmx(t *testing.T) {
+	previous := staticFiles
+	t.Cleanup(func() { staticFiles = previous })
+
+	staticFiles = fstest.MapFS{"quiz.css": {Data: []byte("body {}")}, "quiz.js": {Data: []byte("")}}
+	if _, err := loadStaticAssets(); err == nil || !strings.Contains(err.Error(), "run go generate") {
+		t.Errorf("got %v, want an error saying htmx needs vendoring", err)
+	}
+
+	staticFiles = withStaticFile(staticFiles, "htmx.min.js", "/* htmx */")
+	assets, err := loadStaticAssets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if served := assets.urls["htmx.min.js"]; !strings.HasPrefix(served, "/static/htmx.") {
+		t.Errorf("htmx is loaded from %s, want the server", served)
+	}
+	if policy := assets.contentSecurityPolicy(); !strings.Contains(policy, "script-src 'self';") {
+		t.Errorf("got policy %q, want scripts only from the server", policy)
+	}
+}
+
+// points the package at a new, fully migrated database for the length of the test
+func useTestDatabase(t *testing.T) {
+	t.Helper()
+	previous := databasePath
+	databasePath = filepath.Join(t.TempDir(), "quiz-data.db")
+	t.Cleanup(func() { databasePath = previous })
+
+	if _, err := migrateDatabase(); err != nil {
+		t.Fatalf("migrating test database: %v", err)
+	}
+}
+
+type testQuestion struct {
+	text    string
+	answers []string
+	correct int64
+	// the title of the round the question is in, questions with the same title share a round
+	round string
+}
+
+// creates a quiz in the default organisation with the questions in order and returns their IDs
+func addTestQuiz(t *testing.T, quizId string, name string, questions []testQuestion) []int64 {
+	t.Helper()
+	if _, created := createQuiz(quizId, name); !created {
+		t.Fatalf("creating quiz %s", quizId)
+	}
+
+	rounds := map[string]int64{}
+	var questionIds []int64
+	for i, question := range questions {
+		questionId, err := insertQuestion(BankQuestion{QuestionText: question.text, Answers: question.answers, CorrectAnswer: question.correct})
+		if err != nil {
+			t.Fatalf("adding question %q: %v", question.text, err)
+		}
+		if err := addQuestionToQuiz(quizId, questionId, strconv.Itoa(i+1)); err != nil {
+			t.Fatalf("adding question %d to %s: %v", questionId, quizId, err)
+		}
+		if question.round != "" {
+			if _, found := rounds[question.round]; !found {
+				roundId, err := addRound(Round{QuizId: quizId, Title: question.round, SortOrder: int64(len(rounds) + 1), Multiplier: 1})
+				if err != nil {
+					t.Fatalf("adding round %s: %v", question.round, err)
+				}
+				rounds[question.round] = roundId
+			}
+			if err := updateQuizQuestion(quizId, questionId, map[string]interface{}{"round_id": rounds[question.round]}); err != nil {
+				t.Fatalf("putting question %d in round %s: %v", questionId, question.round, err)
+			}
+		}
+		questionIds = append(questionIds, questionId)
+	}
+	return questionIds
+}
+
+var arithmeticQuestions = []testQuestion{
+	{text: "What is two plus two", answers: []string{"3", "4", "5", "6"}, correct: 2},
+	{text: "What is three times three", answers: []string{"6", "9", "12", "33"}, correct: 2},
+	{text: "What is ten minus one", answers: []string{"9", "8", "11", "10"}, correct: 1},
+}
+
+// the server as it runs in production, admin pages need a login as they do there
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	handler, err := newHandler(false)
+	if err != nil {
+		t.Fatalf("building handler: %v", err)
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// a browser with cookies that doesn't follow redirects, so tests can check where they go
+func newTestClient(t *testing.T) *http.Client {
+	t.Helper()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Client{
+		Jar: jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// sends a form post, as htmx does when htmx is true, and returns the status, Location header and body
+func postForm(t *testing.T, client *http.Client, target string, values url.Values, htmx bool) (int, string, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, target, strings.NewReader(values.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if htmx {
+		req.Header.Set("HX-Request", "true")
+	}
+	return do(t, client, req)
+}
+
+func get(t *testing.T, client *http.Client, target string) (int, string, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return do(t, client, req)
+}
+
+func do(t *testing.T, client *http.Client, req *http.Request) (int, string, string) {
+	t.Helper()
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", req.Method, req.URL, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, resp.Header.Get("Location"), string(body)
+}
+
+func TestGenerateContestantId(t *testing.T) {
+	id := generateContestantId("Rita", "christmas-2023", "Finance")
+
+	if id != generateContestantId("Rita", "christmas-2023", "Finance") {
+		t.Error("the same contestant should always get the same ID")
+	}
+	if id != generateContestantId("Rita", "CHRISTMAS-2023", "finance") {
+		t.Error("quiz and group should be case insensitive")
+	}
+	if id == generateContestantId("rita", "christmas-2023", "finance") {
+		t.Error("names are case sensitive so should get different IDs")
+	}
+	if id == generateContestantId("Rita", "christmas-2023", "legal") {
+		t.Error("the same name in another group should get a different ID")
+	}
+	if _, err := url.QueryUnescape(id); err != nil || url.QueryEscape(id) != strings.ReplaceAll(id, "=", "%3D") {
+		t.Errorf("ID %q should only need its padding escaped in a URL", id)
+	}
+}
+
+func TestRequestQuizFromUrl(t *testing.T) {
+	useTestDatabase(t)
+	if _, err := createOrganisation("finance", "Finance", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path      string
+		wantQuiz  string
+		wantGroup string
+	}{
+		{"/christmas/", "christmas", ""},
+		{"/christmas/legal", "christmas", "legal"},
+		{"/scoreboard/christmas/legal/", "christmas", "legal"},
+		{"/quiz/christmas/", "christmas", ""},
+		{"/org/finance/christmas/legal", "finance:christmas", "legal"},
+		{"/org/finance/scoreboard/christmas/", "finance:christmas", ""},
+		// quiz IDs with the separator in them would reach into another organisation
+		{"/default:christmas/", "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			var gotQuiz, gotGroup string
+			mux := http.NewServeMux()
+			record := func(w http.ResponseWriter, r *http.Request) {
+				gotQuiz, gotGroup = requestQuiz(r)
+			}
+			mux.HandleFunc("GET /{quiz}/{$}", record)
+			mux.HandleFunc("GET /{quiz}/{group}", record)
+			mux.HandleFunc("GET /quiz/{quiz}/{$}", record)
+			mux.HandleFunc("GET /scoreboard/{quiz}/{$}", record)
+			mux.HandleFunc("GET /scoreboard/{quiz}/{group}/{$}", record)
+
+			withOrganisation(mux).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, test.path, nil))
+			if gotQuiz != test.wantQuiz || gotGroup != test.wantGroup {
+				t.Errorf("got quiz %q group %q, want quiz %q group %q", gotQuiz, gotGroup, test.wantQuiz, test.wantGroup)
+			}
+		})
+	}
+}
+
+func TestGetGroupScoresOrdering(t *testing.T) {
+	useTestDatabase(t)
+	questionIds := addTestQuiz(t, "ordering", "Ordering", arithmeticQuestions)
+
+	// name, answers right out of three, seconds taken, finished
+	contestants := []struct {
+		name     string
+		correct  int
+		seconds  int
+		finished bool
+	}{
+		{"Slow and right", 3, 300, true},
+		{"Quick and right", 3, 60, true},
+		{"Quick and wrong", 1, 30, true},
+		{"Still playing", 3, 10, false},
+		{"Middling", 2, 90, true},
+	}
+	for _, contestant := range contestants {
+		contestantId := createContestant("ordering", contestant.name, "legal")
+		finished := interface{}(nil)
+		if contestant.finished {
+			finished = "2026-01-01 20:00:00"
+		}
+		_, err := makeDatabaseQuery(`UPDATE scores SET started = DATETIME('2026-01-01 20:00:00', ?), finished = ?,
+			correct_answers = ?, questions_answered = 3 WHERE contestant_id = ?`,
+			"-"+strconv.Itoa(contestant.seconds)+" seconds", finished, contestant.correct, contestantId)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		details := getContestantDetails(context.Background(), contestantId)
+		for i, questionId := range questionIds {
+			_, question := getQuestionDetails("ordering", details, i+1)
+			if question.QuestionId != questionId {
+				t.Fatalf("question %d is %d, want %d", i+1, question.QuestionId, questionId)
+			}
+			if err := saveAnswer(context.Background(), details, question, 1, i < contestant.correct); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	scores := getGroupScores("ordering", "legal")
+
+	var names []string
+	for _, score := range scores {
+		names = append(names, score.ContestantName)
+	}
+	want := []string{"Quick and right", "Slow and right", "Middling", "Quick and wrong"}
+	if strings.Join(names, ", ") != strings.Join(want, ", ") {
+		t.Errorf("got order %v, want %v", names, want)
+	}
+	if len(scores) > 0 && (scores[0].Points != 3 || scores[0].TimeTaken != "00:01:00") {
+		t.Errorf("winner scored %v in %q, want 3 in 00:01:00", scores[0].Points, scores[0].TimeTaken)
+	}
+	if other := getGroupScores("ordering", "finance"); len(other) != 0 {
+		t.Errorf("another group's scoreboard has %d contestants, want none", len(other))
+	}
+}
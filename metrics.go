@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// request and query latencies are counted into these buckets, in seconds
+var latencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// contestants who have been shown a question this recently and haven't finished count as active
+const activeContestantMinutes = 10
+
+type histogram struct {
+	// counts[i] is the number of observations no bigger than latencyBuckets[i]
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(seconds float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(latencyBuckets))
+	}
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+type requestCount struct {
+	route  string
+	status int
+}
+
+// what's served on /metrics, kept in memory so it starts again from zero when the server restarts
+type Metrics struct {
+	mutex           sync.Mutex
+	requestLatency  map[string]*histogram
+	requests        map[requestCount]uint64
+	queryLatency    map[string]*histogram
+	queryErrors     map[string]uint64
+	answersRecorded map[bool]uint64
+}
+
+var metrics = &Metrics{
+	requestLatency:  map[string]*histogram{},
+	requests:        map[requestCount]uint64{},
+	queryLatency:    map[string]*histogram{},
+	queryErrors:     map[string]uint64{},
+	answersRecorded: map[bool]uint64{},
+}
+
+// only served to requests with "Authorization: Bearer <token>" when METRICS_TOKEN is set
+var metricsToken string
+
+func (m *Metrics) observeRequest(route string, status int, elapsed time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.requestLatency[route] == nil {
+		m.requestLatency[route] = &histogram{}
+	}
+	m.requestLatency[route].observe(elapsed.Seconds())
+	m.requests[requestCount{route, status}]++
+}
+
+// queries are grouped by their first keyword, e.g. SELECT or INSERT
+func queryOperation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "unknown"
+	}
+	return strings.ToUpper(fields[0])
+}
+
+func (m *Metrics) observeQuery(operation string, elapsed time.Duration, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.queryLatency[operation] == nil {
+		m.queryLatency[operation] = &histogram{}
+	}
+	m.queryLatency[operation].observe(elapsed.Seconds())
+	if err != nil {
+		m.queryErrors[operation]++
+	}
+}
+
+func (m *Metrics) answerRecorded(correct bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.answersRecorded[correct]++
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func writeHistogram(w io.Writer, name string, label string, histograms map[string]*histogram) {
+	var keys []string
+	for key := range histograms {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		h := histograms[key]
+		labels := fmt.Sprintf(`%s="%s"`, label, escapeLabel(key))
+		for i, bound := range latencyBuckets {
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, formatFloat(bound), h.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.count)
+	}
+}
+
+// the metrics in the Prometheus text format
+func (m *Metrics) write(w io.Writer, activeContestants int64, answersPerMinute int64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	fmt.Fprintln(w, "# HELP quiz_http_request_duration_seconds Time taken to handle requests, by route.")
+	fmt.Fprintln(w, "# TYPE quiz_http_request_duration_seconds histogram")
+	writeHistogram(w, "quiz_http_request_duration_seconds", "route", m.requestLatency)
+
+	fmt.Fprintln(w, "# HELP quiz_http_requests_total Requests handled, by route and status.")
+	fmt.Fprintln(w, "# TYPE quiz_http_requests_total counter")
+	var counts []requestCount
+	for count := range m.requests {
+		counts = append(counts, count)
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].route != counts[j].route {
+			return counts[i].route < counts[j].route
+		}
+		return counts[i].status < counts[j].status
+	})
+	for _, count := range counts {
+		fmt.Fprintf(w, "quiz_http_requests_total{route=\"%s\",status=\"%d\"} %d\n", escapeLabel(count.route), count.status, m.requests[count])
+	}
+
+	fmt.Fprintln(w, "# HELP quiz_db_query_duration_seconds Time taken by database queries, by operation.")
+	fmt.Fprintln(w, "# TYPE quiz_db_query_duration_seconds histogram")
+	writeHistogram(w, "quiz_db_query_duration_seconds", "operation", m.queryLatency)
+
+	fmt.Fprintln(w, "# HELP quiz_db_query_errors_total Database queries that failed, by operation.")
+	fmt.Fprintln(w, "# TYPE quiz_db_query_errors_total counter")
+	var operations []string
+	for operation := range m.queryErrors {
+		operations = append(operations, operation)
+	}
+	sort.Strings(operations)
+	for _, operation := range operations {
+		fmt.Fprintf(w, "quiz_db_query_errors_total{operation=\"%s\"} %d\n", escapeLabel(operation), m.queryErrors[operation])
+	}
+
+	fmt.Fprintln(w, "# HELP quiz_answers_recorded_total Answers recorded since the server started.")
+	fmt.Fprintln(w, "# TYPE quiz_answers_recorded_total counter")
+	fmt.Fprintf(w, "quiz_answers_recorded_total{correct=\"true\"} %d\n", m.answersRecorded[true])
+	fmt.Fprintf(w, "quiz_answers_recorded_total{correct=\"false\"} %d\n", m.answersRecorded[false])
+
+	fmt.Fprintln(w, "# HELP quiz_answers_per_minute Answers recorded in the last minute.")
+	fmt.Fprintln(w, "# TYPE quiz_answers_per_minute gauge")
+	fmt.Fprintf(w, "quiz_answers_per_minute %d\n", answersPerMinute)
+
+	fmt.Fprintf(w, "# HELP quiz_active_contestants Contestants shown a question in the last %d minutes who haven't finished.\n", activeContestantMinutes)
+	fmt.Fprintln(w, "# TYPE quiz_active_contestants gauge")
+	fmt.Fprintf(w, "quiz_active_contestants %d\n", activeContestants)
+}
+
+// the gauges come from the database rather than memory so they're right straight after a restart
+func countFromDatabase(query string, args ...interface{}) int64 {
+	rows, err := makeDatabaseQuery(query, args...)
+	if err != nil || len(rows) == 0 {
+		return 0
+	}
+	count, _ := rows[0]["count"].(int64)
+	return count
+}
+
+// handles GET /metrics
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if metricsToken != "" {
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(metricsToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	activeContestants := countFromDatabase(`SELECT COUNT(*) AS count FROM scores WHERE finished IS NULL
+		AND question_served >= DATETIME('now', ?)`, fmt.Sprintf("-%d minutes", activeContestantMinutes))
+	answersPerMinute := countFromDatabase("SELECT COUNT(*) AS count FROM answers WHERE answered >= DATETIME('now', '-1 minute')")
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.write(w, activeContestants, answersPerMinute)
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+type Migration struct {
+	Version     int
+	Description string
+	Statements  []string
+}
+
+// migrations are applied in order and recorded in schema_migrations, only ever append to this list
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "baseline schema",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS "quizzes" (
+				"quiz_id"	TEXT NOT NULL UNIQUE,
+				"name"	TEXT NOT NULL,
+				PRIMARY KEY("quiz_id")
+			)`,
+			`CREATE TABLE IF NOT EXISTS "questions" (
+				"quiz_id"	TEXT NOT NULL,
+				"sort_order"	INTEGER NOT NULL,
+				"question"	TEXT NOT NULL,
+				"answer_1"	TEXT,
+				"answer_2"	TEXT,
+				"answer_3"	TEXT,
+				"answer_4"	TEXT,
+				"correct_answer"	INTEGER NOT NULL,
+				"active"	INTEGER NOT NULL DEFAULT 1,
+				"question_id"	INTEGER NOT NULL UNIQUE,
+				PRIMARY KEY("question_id" AUTOINCREMENT)
+			)`,
+			`CREATE TABLE IF NOT EXISTS "scores" (
+				"score_id"	INTEGER,
+				"quiz_id"	TEXT,
+				"group"	TEXT NOT NULL,
+				"name"	TEXT NOT NULL,
+				"started"	NUMERIC,
+				"finished"	NUMERIC,
+				"correct_answers"	INTEGER NOT NULL,
+				"questions_answered"	INTEGER NOT NULL,
+				"contestant_id"	TEXT NOT NULL UNIQUE,
+				PRIMARY KEY("score_id" AUTOINCREMENT)
+			)`,
+		},
+	},
+	{
+		Version:     2,
+		Description: "record individual answers",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS "answers" (
+				"answer_id"	INTEGER NOT NULL,
+				"contestant_id"	TEXT NOT NULL,
+				"quiz_id"	TEXT NOT NULL,
+				"question_id"	INTEGER NOT NULL,
+				"selected_answer"	INTEGER NOT NULL,
+				"correct"	INTEGER NOT NULL,
+				"answered"	NUMERIC NOT NULL DEFAULT (DATETIME('now')),
+				PRIMARY KEY("answer_id" AUTOINCREMENT)
+			)`,
+			`CREATE INDEX IF NOT EXISTS answers_contestant ON answers(contestant_id)`,
+			`CREATE INDEX IF NOT EXISTS answers_quiz ON answers(quiz_id, question_id)`,
+		},
+	},
+	{
+		Version:     3,
+		Description: "track time taken to answer each question",
+		Statements: []string{
+			`ALTER TABLE scores ADD COLUMN "question_served" NUMERIC`,
+			`ALTER TABLE answers ADD COLUMN "time_taken_seconds" REAL`,
+		},
+	},
+	{
+		Version:     4,
+		Description: "question bank shared between quizzes",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS "quiz_questions" (
+				"quiz_id"	TEXT NOT NULL,
+				"question_id"	INTEGER NOT NULL,
+				"sort_order"	INTEGER NOT NULL,
+				"active"	INTEGER NOT NULL DEFAULT 1,
+				PRIMARY KEY("quiz_id", "question_id")
+			)`,
+			`INSERT INTO quiz_questions(quiz_id, question_id, sort_order, active) SELECT quiz_id, question_id, sort_order, active FROM questions`,
+			`CREATE TABLE IF NOT EXISTS "question_tags" (
+				"question_id"	INTEGER NOT NULL,
+				"tag"	TEXT NOT NULL,
+				PRIMARY KEY("question_id", "tag")
+			)`,
+			// tag existing questions with the quiz they were written for so they can still be found
+			`INSERT INTO question_tags(question_id, tag) SELECT question_id, LOWER(quiz_id) FROM questions`,
+			`ALTER TABLE questions ADD COLUMN "category" TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE questions ADD COLUMN "difficulty" TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE questions ADD COLUMN "author" TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE questions DROP COLUMN "quiz_id"`,
+			`ALTER TABLE questions DROP COLUMN "sort_order"`,
+			`ALTER TABLE questions DROP COLUMN "active"`,
+		},
+	},
+	{
+		Version:     5,
+		Description: "shuffle question and answer order per contestant",
+		Statements: []string{
+			`ALTER TABLE quizzes ADD COLUMN "shuffle_questions" INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE quizzes ADD COLUMN "shuffle_answers" INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE scores ADD COLUMN "shuffle_seed" INTEGER`,
+			`UPDATE scores SET shuffle_seed = ABS(RANDOM()) WHERE shuffle_seed IS NULL`,
+		},
+	},
+	{
+		Version:     6,
+		Description: "sample questions from a pool per contestant",
+		Statements: []string{
+			`ALTER TABLE quizzes ADD COLUMN "sample_size" INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE quizzes ADD COLUMN "sample_stratify" TEXT NOT NULL DEFAULT ''`,
+			`CREATE TABLE IF NOT EXISTS "contestant_questions" (
+				"contestant_id"	TEXT NOT NULL,
+				"position"	INTEGER NOT NULL,
+				"question_id"	INTEGER NOT NULL,
+				PRIMARY KEY("contestant_id", "position")
+			)`,
+		},
+	},
+	{
+		Version:     7,
+		Description: "rounds within a quiz",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS "rounds" (
+				"round_id"	INTEGER NOT NULL,
+				"quiz_id"	TEXT NOT NULL,
+				"title"	TEXT NOT NULL,
+				"intro"	TEXT NOT NULL DEFAULT '',
+				"sort_order"	INTEGER NOT NULL DEFAULT 0,
+				"time_limit_seconds"	INTEGER NOT NULL DEFAULT 0,
+				"multiplier"	REAL NOT NULL DEFAULT 1,
+				PRIMARY KEY("round_id" AUTOINCREMENT)
+			)`,
+			`CREATE INDEX IF NOT EXISTS "rounds_quiz" ON "rounds" ("quiz_id", "sort_order")`,
+			`ALTER TABLE quiz_questions ADD COLUMN "round_id" INTEGER`,
+			`ALTER TABLE answers ADD COLUMN "round_id" INTEGER`,
+			`ALTER TABLE answers ADD COLUMN "points" REAL NOT NULL DEFAULT 0`,
+			`UPDATE answers SET points = correct`,
+			`CREATE TABLE IF NOT EXISTS "contestant_rounds" (
+				"contestant_id"	TEXT NOT NULL,
+				"round_id"	INTEGER NOT NULL,
+				"started"	TEXT NOT NULL,
+				PRIMARY KEY("contestant_id", "round_id")
+			)`,
+		},
+	},
+	{
+		Version:     8,
+		Description: "scoring rules per quiz",
+		Statements: []string{
+			`ALTER TABLE quiz_questions ADD COLUMN "points" REAL NOT NULL DEFAULT 1`,
+			`ALTER TABLE quizzes ADD COLUMN "negative_marking" REAL NOT NULL DEFAULT 0`,
+			`ALTER TABLE quizzes ADD COLUMN "speed_bonus" REAL NOT NULL DEFAULT 0`,
+			`ALTER TABLE quizzes ADD COLUMN "speed_bonus_seconds" INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE quizzes ADD COLUMN "streak_bonus" REAL NOT NULL DEFAULT 0`,
+			`ALTER TABLE quizzes ADD COLUMN "tie_breaker" TEXT NOT NULL DEFAULT 'time'`,
+			`ALTER TABLE quizzes ADD COLUMN "estimate_question" TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE quizzes ADD COLUMN "estimate_answer" REAL NOT NULL DEFAULT 0`,
+			`ALTER TABLE scores ADD COLUMN "estimate" REAL`,
+		},
+	},
+	{
+		Version:     9,
+		Description: "joker and 50/50 power-ups",
+		Statements: []string{
+			`ALTER TABLE quizzes ADD COLUMN "jokers" INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE quizzes ADD COLUMN "fifty_fifty" INTEGER NOT NULL DEFAULT 0`,
+			`CREATE TABLE IF NOT EXISTS "contestant_powerups" (
+				"contestant_id"	TEXT NOT NULL,
+				"powerup"	TEXT NOT NULL,
+				"question_id"	INTEGER,
+				"round_id"	INTEGER,
+				"played"	TEXT NOT NULL DEFAULT (DATETIME('now')),
+				PRIMARY KEY("contestant_id", "powerup")
+			)`,
+		},
+	},
+	{
+		Version:     10,
+		Description: "open and close times for quizzes and groups",
+		Statements: []string{
+			`ALTER TABLE quizzes ADD COLUMN "opens_at" TEXT`,
+			`ALTER TABLE quizzes ADD COLUMN "closes_at" TEXT`,
+			`CREATE TABLE IF NOT EXISTS "group_schedules" (
+				"quiz_id"	TEXT NOT NULL,
+				"group"	TEXT NOT NULL,
+				"opens_at"	TEXT,
+				"closes_at"	TEXT,
+				PRIMARY KEY("quiz_id", "group")
+			)`,
+		},
+	},
+	{
+		Version:     11,
+		Description: "organisations",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS "organisations" (
+				"org_id"	TEXT NOT NULL,
+				"name"	TEXT NOT NULL,
+				"host"	TEXT UNIQUE COLLATE NOCASE,
+				"admin_key_hash"	TEXT NOT NULL DEFAULT '',
+				PRIMARY KEY("org_id")
+			)`,
+			`INSERT INTO organisations(org_id, name) VALUES ('default', 'Default')`,
+			`ALTER TABLE quizzes ADD COLUMN "org_id" TEXT NOT NULL DEFAULT 'default'`,
+			`ALTER TABLE questions ADD COLUMN "org_id" TEXT NOT NULL DEFAULT 'default'`,
+			`CREATE INDEX IF NOT EXISTS "questions_org" ON "questions" ("org_id")`,
+		},
+	},
+	{
+		Version:     12,
+		Description: "admin roles and audit trail",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS "admin_users" (
+				"org_id"	TEXT NOT NULL,
+				"username"	TEXT NOT NULL,
+				"key_hash"	TEXT NOT NULL,
+				PRIMARY KEY("org_id", "username")
+			)`,
+			`CREATE TABLE IF NOT EXISTS "admin_roles" (
+				"org_id"	TEXT NOT NULL,
+				"username"	TEXT NOT NULL,
+				"role"	TEXT NOT NULL,
+				"quiz_id"	TEXT NOT NULL DEFAULT '',
+				PRIMARY KEY("org_id", "username", "role", "quiz_id")
+			)`,
+			`CREATE TABLE IF NOT EXISTS "audit_log" (
+				"audit_id"	INTEGER NOT NULL,
+				"org_id"	TEXT NOT NULL,
+				"username"	TEXT NOT NULL,
+				"action"	TEXT NOT NULL,
+				"quiz_id"	TEXT NOT NULL DEFAULT '',
+				"details"	TEXT NOT NULL DEFAULT '',
+				"at"	TEXT NOT NULL DEFAULT (DATETIME('now')),
+				PRIMARY KEY("audit_id" AUTOINCREMENT)
+			)`,
+			`CREATE INDEX IF NOT EXISTS "audit_log_org" ON "audit_log" ("org_id", "quiz_id")`,
+		},
+	},
+	{
+		Version:     13,
+		Description: "quiz themes and feedback messages",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS "quiz_themes" (
+				"quiz_id"	TEXT NOT NULL,
+				"preset"	TEXT NOT NULL DEFAULT 'classic',
+				"background_colour"	TEXT,
+				"panel_colour"	TEXT,
+				"text_colour"	TEXT,
+				"accent_colour"	TEXT,
+				"accent_dark_colour"	TEXT,
+				"error_colour"	TEXT,
+				"font"	TEXT,
+				"logo_url"	TEXT,
+				"background_image_url"	TEXT,
+				PRIMARY KEY("quiz_id")
+			)`,
+			`CREATE TABLE IF NOT EXISTS "quiz_feedback" (
+				"feedback_id"	INTEGER NOT NULL,
+				"quiz_id"	TEXT NOT NULL,
+				"kind"	TEXT NOT NULL,
+				"message"	TEXT NOT NULL,
+				PRIMARY KEY("feedback_id" AUTOINCREMENT)
+			)`,
+			`CREATE INDEX IF NOT EXISTS "quiz_feedback_quiz" ON "quiz_feedback" ("quiz_id", "kind")`,
+			// existing quizzes keep the christmas colours and jokes they were written with
+			`INSERT OR IGNORE INTO "quiz_themes"("quiz_id", "preset") SELECT "quiz_id", 'christmas' FROM "quizzes"`,
+		},
+	},
+	{
+		Version:     14,
+		Description: "quiz locales and question translations",
+		Statements: []string{
+			`ALTER TABLE "quizzes" ADD COLUMN "locale" TEXT NOT NULL DEFAULT ''`,
+			`CREATE TABLE IF NOT EXISTS "question_translations" (
+				"question_id"	INTEGER NOT NULL,
+				"locale"	TEXT NOT NULL,
+				"question"	TEXT NOT NULL DEFAULT '',
+				"answer_1"	TEXT NOT NULL DEFAULT '',
+				"answer_2"	TEXT NOT NULL DEFAULT '',
+				"answer_3"	TEXT NOT NULL DEFAULT '',
+				"answer_4"	TEXT NOT NULL DEFAULT '',
+				PRIMARY KEY("question_id", "locale")
+			)`,
+		},
+	},
+	{
+		Version:     15,
+		Description: "integrity checks and score reviews",
+		Statements: []string{
+			`ALTER TABLE "quizzes" ADD COLUMN "integrity_checks" INTEGER NOT NULL DEFAULT 0`,
+			`CREATE TABLE IF NOT EXISTS "integrity_events" (
+				"event_id"	INTEGER NOT NULL,
+				"contestant_id"	TEXT NOT NULL,
+				"quiz_id"	TEXT NOT NULL,
+				"question"	INTEGER NOT NULL,
+				"seconds_away"	REAL NOT NULL,
+				"at"	TEXT NOT NULL DEFAULT (DATETIME('now')),
+				PRIMARY KEY("event_id" AUTOINCREMENT)
+			)`,
+			`CREATE INDEX IF NOT EXISTS "integrity_events_quiz" ON "integrity_events" ("quiz_id", "contestant_id")`,
+			`ALTER TABLE "scores" ADD COLUMN "review_note" TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE "scores" ADD COLUMN "penalty" REAL NOT NULL DEFAULT 0`,
+			`ALTER TABLE "scores" ADD COLUMN "disqualified" INTEGER NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		Version:     16,
+		Description: "registration limits",
+		Statements: []string{
+			`ALTER TABLE "quizzes" ADD COLUMN "max_group_size" INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE "quizzes" ADD COLUMN "proof_of_work" INTEGER NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		Version:     17,
+		Description: "question served position",
+		Statements: []string{
+			`ALTER TABLE "scores" ADD COLUMN "served_position" INTEGER`,
+		},
+	},
+	{
+		Version:     18,
+		Description: "correct answer kept with each answer",
+		Statements: []string{
+			`ALTER TABLE "answers" ADD COLUMN "correct_answer" INTEGER`,
+		},
+	},
+}
+
+func currentSchemaVersion() (int, error) {
+	db, err := openDatabase()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER NOT NULL PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied TEXT NOT NULL DEFAULT (DATETIME('now'))
+	)`)
+	if err != nil {
+		return 0, err
+	}
+
+	var version int
+	err = db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
+
+func latestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// applies any migrations newer than the recorded schema version, each one in its own transaction
+func migrateDatabase() (int, error) {
+	version, err := currentSchemaVersion()
+	if err != nil {
+		return 0, fmt.Errorf("reading schema version: %w", err)
+	}
+
+	db, err := openDatabase()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	applied := 0
+	for _, migration := range migrations {
+		if migration.Version <= version {
+			continue
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return applied, err
+		}
+		for _, statement := range migration.Statements {
+			if _, err := tx.Exec(statement); err != nil {
+				tx.Rollback()
+				return applied, fmt.Errorf("migration %d (%s): %w", migration.Version, migration.Description, err)
+			}
+		}
+		_, err = tx.Exec("INSERT INTO schema_migrations(version, description) VALUES (?, ?)", migration.Version, migration.Description)
+		if err != nil {
+			tx.Rollback()
+			return applied, err
+		}
+		if err := tx.Commit(); err != nil {
+			return applied, err
+		}
+
+		slog.Info("Applied migration", "version", migration.Version, "description", migration.Description)
+		applied++
+	}
+
+	return applied, nil
+}
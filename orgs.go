@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// quizzes, their groups and the question bank belong to an organisation so departments sharing a server can reuse
+// quiz IDs without seeing each other's data. Everything created before organisations existed is in the default one
+type Organisation struct {
+	OrgId string
+	Name  string
+	Host  string
+	// where the organisation's pages live, "/org/<org id>" when picked by the URL or empty when picked by host name
+	BasePath     string
+	adminKeyHash string
+}
+
+const defaultOrganisation = "default"
+
+// separates the organisation from the quiz ID in the ID stored in the database, never allowed in either
+const orgQuizSeparator = ":"
+
+var orgIdPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// quiz IDs show up in URLs so are limited to characters that don't need escaping
+var quizIdPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+type organisationContextKey struct{}
+
+func validateOrgId(orgId string) error {
+	if !orgIdPattern.MatchString(orgId) {
+		return fmt.Errorf("organisation ID must be lower case letters, numbers and dashes, got %q", orgId)
+	}
+	return nil
+}
+
+func validateQuizId(quizId string) error {
+	if !quizIdPattern.MatchString(quizId) {
+		return fmt.Errorf("quiz ID must be letters, numbers, dots, dashes and underscores, got %q", quizId)
+	}
+	return nil
+}
+
+// the ID a quiz is stored under, quizzes in the default organisation keep the ID they are known by
+func scopedQuizId(orgId string, quizId string) string {
+	if quizId == "" || orgId == "" || orgId == defaultOrganisation {
+		return quizId
+	}
+	return orgId + orgQuizSeparator + quizId
+}
+
+// the ID used in URLs and shown to people, without the organisation
+func publicQuizId(quizId string) string {
+	if _, public, found := strings.Cut(quizId, orgQuizSeparator); found {
+		return public
+	}
+	return quizId
+}
+
+func quizOrganisation(quizId string) string {
+	if orgId, _, found := strings.Cut(quizId, orgQuizSeparator); found {
+		return orgId
+	}
+	return defaultOrganisation
+}
+
+func hashAdminKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateAdminKey() (string, error) {
+	key := make([]byte, 18)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
+
+func (org Organisation) adminKeyMatches(key string) bool {
+	if org.adminKeyHash == "" || key == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashAdminKey(key)), []byte(org.adminKeyHash)) == 1
+}
+
+func organisationFromRow(row map[string]interface{}) Organisation {
+	org := Organisation{
+		OrgId:        row["org_id"].(string),
+		Name:         row["name"].(string),
+		adminKeyHash: row["admin_key_hash"].(string),
+	}
+	org.Host, _ = row["host"].(string)
+	return org
+}
+
+func listOrganisations() ([]Organisation, error) {
+	rows, err := makeDatabaseQuery("SELECT org_id, name, host, admin_key_hash FROM organisations ORDER BY org_id")
+	if err != nil {
+		return nil, err
+	}
+
+	var orgs []Organisation
+	for _, row := range rows {
+		orgs = append(orgs, organisationFromRow(row))
+	}
+	return orgs, nil
+}
+
+// finds an organisation by ID or, if column is "host", by the host name it is served on
+func findOrganisation(column string, value string) (Organisation, bool, error) {
+	if column != "org_id" && column != "host" {
+		return Organisation{}, false, fmt.Errorf("can't look up organisations by %s", column)
+	}
+	rows, err := makeDatabaseQuery("SELECT org_id, name, host, admin_key_hash FROM organisations WHERE "+column+" = ? COLLATE NOCASE", value)
+	if err != nil || len(rows) == 0 {
+		return Organisation{}, false, err
+	}
+	return organisationFromRow(rows[0]), true, nil
+}
+
+// creates the organisation and returns the admin key for it, only a hash of the key is kept
+func createOrganisation(orgId string, name string, host string) (string, error) {
+	if err := validateOrgId(orgId); err != nil {
+		return "", err
+	}
+	key, err := generateAdminKey()
+	if err != nil {
+		return "", err
+	}
+
+	var hostValue interface{}
+	if host != "" {
+		hostValue = strings.ToLower(host)
+	}
+
+	db, err := openDatabase()
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	_, err = db.Exec("INSERT INTO organisations(org_id, name, host, admin_key_hash) VALUES (?, ?, ?, ?)", orgId, name, hostValue, hashAdminKey(key))
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// changes maps name and/or host to their new values, an empty host stops the organisation being picked by host name
+func updateOrganisation(orgId string, changes map[string]string) error {
+	var setClauses []string
+	var args []interface{}
+	for _, column := range []string{"host", "name"} {
+		value, found := changes[column]
+		if !found {
+			continue
+		}
+		setClauses = append(setClauses, column+" = ?")
+		if column == "host" && value == "" {
+			args = append(args, nil)
+		} else if column == "host" {
+			args = append(args, strings.ToLower(value))
+		} else {
+			args = append(args, value)
+		}
+	}
+	if len(setClauses) == 0 {
+		return errors.New("no changes to apply")
+	}
+
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	result, err := db.Exec("UPDATE organisations SET "+strings.Join(setClauses, ", ")+" WHERE org_id = ?", append(args, orgId)...)
+	if err != nil {
+		return err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return fmt.Errorf("no organisation found with ID %s", orgId)
+	}
+	return nil
+}
+
+// replaces the organisation's admin key, returning the new one
+func rotateAdminKey(orgId string) (string, error) {
+	key, err := generateAdminKey()
+	if err != nil {
+		return "", err
+	}
+
+	db, err := openDatabase()
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	result, err := db.Exec("UPDATE organisations SET admin_key_hash = ? WHERE org_id = ?", hashAdminKey(key), orgId)
+	if err != nil {
+		return "", err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return "", fmt.Errorf("no organisation found with ID %s", orgId)
+	}
+	return key, nil
+}
+
+func questionInOrganisation(orgId string, questionId int64) (bool, error) {
+	rows, err := makeDatabaseQuery("SELECT COUNT(*) AS found FROM questions WHERE question_id = ? AND org_id = ?", questionId, orgId)
+	if err != nil {
+		return false, err
+	}
+	return rows[0]["found"].(int64) > 0, nil
+}
+
+func roundInOrganisation(orgId string, roundId int64) (bool, error) {
+	rows, err := makeDatabaseQuery(`SELECT COUNT(*) AS found FROM rounds JOIN quizzes ON quizzes.quiz_id = rounds.quiz_id
+		WHERE rounds.round_id = ? AND quizzes.org_id = ?`, roundId, orgId)
+	if err != nil {
+		return false, err
+	}
+	return rows[0]["found"].(int64) > 0, nil
+}
+
+func contestantInOrganisation(orgId string, contestantId string) (bool, error) {
+	rows, err := makeDatabaseQuery(`SELECT COUNT(*) AS found FROM scores JOIN quizzes ON quizzes.quiz_id = scores.quiz_id
+		WHERE scores.contestant_id = ? AND quizzes.org_id = ?`, contestantId, orgId)
+	if err != nil {
+		return false, err
+	}
+	return rows[0]["found"].(int64) > 0, nil
+}
+
+// works out which organisation a request is for, either from an /org/<org id>/ prefix (which is removed before the
+// request is handled) or from the host name, falling back to the default organisation
+func withOrganisation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var org Organisation
+		var found bool
+		var err error
+
+		if rest, prefixed := strings.CutPrefix(r.URL.Path, "/org/"); prefixed {
+			orgId, path, _ := strings.Cut(rest, "/")
+			org, found, err = findOrganisation("org_id", orgId)
+			if err == nil && !found {
+				http.NotFound(w, r)
+				return
+			}
+			org.BasePath = "/org/" + org.OrgId
+			r.URL.Path = "/" + path
+			r.URL.RawPath = ""
+		} else {
+			host, _, splitErr := net.SplitHostPort(r.Host)
+			if splitErr != nil {
+				host = r.Host
+			}
+			org, found, err = findOrganisation("host", host)
+			if err == nil && !found {
+				org, found, err = findOrganisation("org_id", defaultOrganisation)
+			}
+		}
+		if err != nil {
+			requestLogger(r).Error("Error finding organisation", "host", r.Host, "path", r.URL.Path, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			org = Organisation{OrgId: defaultOrganisation}
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), organisationContextKey{}, org)))
+	})
+}
+
+func requestOrganisation(r *http.Request) Organisation {
+	if org, ok := r.Context().Value(organisationContextKey{}).(Organisation); ok {
+		return org
+	}
+	return Organisation{OrgId: defaultOrganisation}
+}
+
+// true if the quiz belongs to the organisation the request is for
+func quizInRequestOrganisation(r *http.Request, quizId string) bool {
+	return quizId != "" && quizOrganisation(quizId) == requestOrganisation(r).OrgId
+}
+
+// admin pages are refused with a login prompt for organisations with their own admin key, so the browser asks for it
+func refuseAdmin(w http.ResponseWriter, r *http.Request) {
+	org := requestOrganisation(r)
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", org.Name+" quiz admin"))
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
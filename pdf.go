@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Helvetica glyph widths (per 1000 units of font size) for the printable ASCII range, taken from the standard AFM metrics
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+type Certificate struct {
+	QuizName       string
+	Group          string
+	ContestantName string
+	CorrectAnswers int64
+	TotalQuestions int64
+	Points         float64
+	MaxPoints      float64
+	TimeTaken      string
+	Date           string
+}
+
+type pdfTextLine struct {
+	Text     string
+	Size     float64
+	Bold     bool
+	Baseline float64
+}
+
+// PDF strings use WinAnsiEncoding with the standard fonts, Latin-1 maps directly and anything else is replaced
+func pdfEncodeText(text string) []byte {
+	var encoded []byte
+	for _, r := range text {
+		switch {
+		case r >= 32 && r <= 126:
+			encoded = append(encoded, byte(r))
+		case r >= 0xA0 && r <= 0xFF:
+			encoded = append(encoded, byte(r))
+		case r == '‘' || r == '’':
+			encoded = append(encoded, '\'')
+		case r == '“' || r == '”':
+			encoded = append(encoded, '"')
+		case r == '–' || r == '—':
+			encoded = append(encoded, '-')
+		default:
+			encoded = append(encoded, '?')
+		}
+	}
+	return encoded
+}
+
+func pdfEscape(encoded []byte) string {
+	var escaped strings.Builder
+	for _, b := range encoded {
+		if b == '(' || b == ')' || b == '\\' {
+			escaped.WriteByte('\\')
+		}
+		escaped.WriteByte(b)
+	}
+	return escaped.String()
+}
+
+// approximate width in points, bold text is roughly 5% wider than regular Helvetica
+func pdfTextWidth(encoded []byte, size float64, bold bool) float64 {
+	total := 0
+	for _, b := range encoded {
+		if b >= 32 && b <= 126 {
+			total += helveticaWidths[b-32]
+		} else {
+			total += 556
+		}
+	}
+	width := float64(total) * size / 1000
+	if bold {
+		width *= 1.05
+	}
+	return width
+}
+
+func certificatePageContent(certificate Certificate, pageWidth float64, pageHeight float64) []byte {
+	var content bytes.Buffer
+
+	// gold double border
+	content.WriteString("0.75 0.58 0.25 RG\n")
+	content.WriteString("4 w\n")
+	fmt.Fprintf(&content, "30 30 %.2f %.2f re S\n", pageWidth-60, pageHeight-60)
+	content.WriteString("1 w\n")
+	fmt.Fprintf(&content, "42 42 %.2f %.2f re S\n", pageWidth-84, pageHeight-84)
+
+	scoreLine := fmt.Sprintf("%d out of %d correct", certificate.CorrectAnswers, certificate.TotalQuestions)
+	// with weighted questions or bonuses the points are what won, not the number correct
+	if certificate.Points != float64(certificate.CorrectAnswers) || certificate.MaxPoints != float64(certificate.TotalQuestions) {
+		scoreLine = fmt.Sprintf("%s out of %s points", strconv.FormatFloat(certificate.Points, 'f', -1, 64), strconv.FormatFloat(certificate.MaxPoints, 'f', -1, 64))
+	}
+	if certificate.TimeTaken != "" {
+		scoreLine = fmt.Sprintf("%s in %s", scoreLine, certificate.TimeTaken)
+	}
+
+	lines := []pdfTextLine{
+		{Text: "Certificate of Achievement", Size: 36, Bold: true, Baseline: pageHeight - 140},
+		{Text: "This certificate is awarded to", Size: 16, Baseline: pageHeight - 210},
+		{Text: certificate.ContestantName, Size: 40, Bold: true, Baseline: pageHeight - 275},
+		{Text: fmt.Sprintf("for winning the %s group of the %s quiz", certificate.Group, certificate.QuizName), Size: 16, Baseline: pageHeight - 330},
+		{Text: scoreLine, Size: 16, Baseline: pageHeight - 360},
+		{Text: certificate.Date, Size: 12, Baseline: 80},
+	}
+
+	content.WriteString("0.2 0.23 0.25 rg\n")
+	for _, line := range lines {
+		encoded := pdfEncodeText(line.Text)
+		font := "F1"
+		if line.Bold {
+			font = "F2"
+		}
+		x := (pageWidth - pdfTextWidth(encoded, line.Size, line.Bold)) / 2
+		fmt.Fprintf(&content, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, line.Size, x, line.Baseline, pdfEscape(encoded))
+	}
+
+	return content.Bytes()
+}
+
+// writes a landscape A4 PDF with one page per certificate, using only the built-in Helvetica fonts so nothing needs embedding
+func writeCertificatesPDF(w io.Writer, certificates []Certificate) error {
+	const pageWidth, pageHeight = 842.0, 595.0
+
+	var objects [][]byte
+	addObject := func(body string) int {
+		objects = append(objects, []byte(body))
+		return len(objects)
+	}
+
+	catalogId := addObject("")
+	pagesId := addObject("")
+	regularFontId := addObject("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	boldFontId := addObject("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	var pageIds []string
+	for _, certificate := range certificates {
+		content := certificatePageContent(certificate, pageWidth, pageHeight)
+		contentId := addObject(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content))
+		pageId := addObject(fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 %d 0 R /F2 %d 0 R >> >> /Contents %d 0 R >>",
+			pagesId, pageWidth, pageHeight, regularFontId, boldFontId, contentId))
+		pageIds = append(pageIds, fmt.Sprintf("%d 0 R", pageId))
+	}
+
+	objects[catalogId-1] = []byte(fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesId))
+	objects[pagesId-1] = []byte(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(pageIds, " "), len(pageIds)))
+
+	var document bytes.Buffer
+	document.WriteString("%PDF-1.4\n%\xE2\xE3\xCF\xD3\n")
+
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = document.Len()
+		fmt.Fprintf(&document, "%d 0 obj\n", i+1)
+		document.Write(object)
+		document.WriteString("\nendobj\n")
+	}
+
+	xrefOffset := document.Len()
+	fmt.Fprintf(&document, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&document, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&document, "trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, catalogId, xrefOffset)
+
+	_, err := w.Write(document.Bytes())
+	return err
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// what an admin can do, each role grants a set of these
+const (
+	permissionEditQuestions = "edit_questions"
+	permissionManageGroups  = "manage_groups"
+	permissionViewResults   = "view_results"
+)
+
+var rolePermissions = map[string][]string{
+	"owner":  {permissionEditQuestions, permissionManageGroups, permissionViewResults},
+	"author": {permissionEditQuestions, permissionViewResults},
+	"host":   {permissionManageGroups, permissionViewResults},
+	"viewer": {permissionViewResults},
+}
+
+// someone logged in to an organisation's admin pages with basic auth. Logging in with the organisation's own admin key
+// makes you its owner, everyone else can only do what their role grants allow
+type AdminUser struct {
+	OrgId    string
+	Username string
+	owner    bool
+}
+
+// a role given to an admin for the whole organisation (an empty quiz ID) or a single quiz
+type RoleGrant struct {
+	Username string
+	Role     string
+	QuizId   string
+}
+
+func validateRole(role string) error {
+	if _, found := rolePermissions[role]; found {
+		return nil
+	}
+	var roles []string
+	for role := range rolePermissions {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	return fmt.Errorf("role must be one of %s, got %q", strings.Join(roles, ", "), role)
+}
+
+func validateUsername(username string) error {
+	if !orgIdPattern.MatchString(username) {
+		return fmt.Errorf("user name must be lower case letters, numbers and dashes, got %q", username)
+	}
+	return nil
+}
+
+// adds an admin to the organisation and returns their key, only a hash of the key is kept
+func addAdminUser(orgId string, username string) (string, error) {
+	if err := validateUsername(username); err != nil {
+		return "", err
+	}
+	// the organisation ID is the user name for logging in with the organisation's own key
+	if username == orgId {
+		return "", fmt.Errorf("%s is used for the organisation's own admin key, pick another user name", username)
+	}
+	key, err := generateAdminKey()
+	if err != nil {
+		return "", err
+	}
+
+	db, err := openDatabase()
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	_, err = db.Exec("INSERT INTO admin_users(org_id, username, key_hash) VALUES (?, ?, ?)", orgId, username, hashAdminKey(key))
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// removes the admin and all their roles
+func removeAdminUser(orgId string, username string) error {
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	result, err := tx.Exec("DELETE FROM admin_users WHERE org_id = ? AND username = ?", orgId, username)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if removed, _ := result.RowsAffected(); removed == 0 {
+		tx.Rollback()
+		return fmt.Errorf("no admin found with user name %s", username)
+	}
+	if _, err := tx.Exec("DELETE FROM admin_roles WHERE org_id = ? AND username = ?", orgId, username); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func adminUserExists(orgId string, username string) (bool, error) {
+	rows, err := makeDatabaseQuery("SELECT COUNT(*) AS found FROM admin_users WHERE org_id = ? AND username = ?", orgId, username)
+	if err != nil {
+		return false, err
+	}
+	return rows[0]["found"].(int64) > 0, nil
+}
+
+// quizId is the stored ID of the quiz, or empty to give the role for every quiz in the organisation
+func grantRole(orgId string, grant RoleGrant) error {
+	if err := validateRole(grant.Role); err != nil {
+		return err
+	}
+	exists, err := adminUserExists(orgId, grant.Username)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("no admin found with user name %s", grant.Username)
+	}
+
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec("INSERT OR IGNORE INTO admin_roles(org_id, username, role, quiz_id) VALUES (?, ?, ?, ?)", orgId, grant.Username, grant.Role, grant.QuizId)
+	return err
+}
+
+func revokeRole(orgId string, grant RoleGrant) error {
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	result, err := db.Exec("DELETE FROM admin_roles WHERE org_id = ? AND username = ? AND role = ? AND quiz_id = ?", orgId, grant.Username, grant.Role, grant.QuizId)
+	if err != nil {
+		return err
+	}
+	if removed, _ := result.RowsAffected(); removed == 0 {
+		return fmt.Errorf("%s doesn't have that role", grant.Username)
+	}
+	return nil
+}
+
+// roles in the organisation, for one admin if username isn't empty
+func listRoles(orgId string, username string) ([]RoleGrant, error) {
+	query := "SELECT username, role, quiz_id FROM admin_roles WHERE org_id = ?"
+	args := []interface{}{orgId}
+	if username != "" {
+		query += " AND username = ?"
+		args = append(args, username)
+	}
+	rows, err := makeDatabaseQuery(query+" ORDER BY username, quiz_id, role", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var grants []RoleGrant
+	for _, row := range rows {
+		grants = append(grants, RoleGrant{
+			Username: row["username"].(string),
+			Role:     row["role"].(string),
+			QuizId:   row["quiz_id"].(string),
+		})
+	}
+	return grants, nil
+}
+
+// works out who is logged in to the request's organisation, if anyone
+func requestAdmin(r *http.Request) (AdminUser, bool) {
+	org := requestOrganisation(r)
+
+	username, key, found := r.BasicAuth()
+	if !found || key == "" {
+		return AdminUser{}, false
+	}
+	if username == org.OrgId {
+		return AdminUser{OrgId: org.OrgId, Username: "owner", owner: true}, org.adminKeyMatches(key)
+	}
+
+	rows, err := makeDatabaseQuery("SELECT key_hash FROM admin_users WHERE org_id = ? AND username = ?", org.OrgId, username)
+	if err != nil {
+		requestLogger(r).Error("Error looking up admin", "username", username, "error", err)
+		return AdminUser{}, false
+	}
+	if len(rows) == 0 || !(Organisation{adminKeyHash: rows[0]["key_hash"].(string)}).adminKeyMatches(key) {
+		return AdminUser{}, false
+	}
+	return AdminUser{OrgId: org.OrgId, Username: username}, true
+}
+
+// the owner of the default organisation runs the server, so can do things that cover every organisation
+func (admin AdminUser) isServerOwner() bool {
+	return admin.owner && admin.OrgId == defaultOrganisation
+}
+
+// true if the admin has the permission for the quiz, or for any quiz if quizId is empty
+func (admin AdminUser) can(permission string, quizId string) bool {
+	if admin.owner {
+		return true
+	}
+	grants, err := listRoles(admin.OrgId, admin.Username)
+	if err != nil {
+		slog.Error("Error getting roles", "username", admin.Username, "error", err)
+		return false
+	}
+	for _, grant := range grants {
+		if grant.QuizId != "" && quizId != "" && grant.QuizId != quizId {
+			continue
+		}
+		for _, granted := range rolePermissions[grant.Role] {
+			if granted == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// where an admin route finds the quiz being worked on, an empty ID means the route isn't about a single quiz
+func quizFromPath(r *http.Request) string {
+	quizId, _ := requestQuiz(r)
+	return quizId
+}
+
+func quizFromForm(r *http.Request) string {
+	return scopedQuizId(requestOrganisation(r).OrgId, r.PostFormValue("quiz_id"))
+}
+
+// only lets admins with the permission for the quiz the route works on through
+func requirePermission(permission string, quizOf func(r *http.Request) string) middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			admin, loggedIn := requestAdmin(r)
+			if !loggedIn {
+				refuseAdmin(w, r)
+				return
+			}
+			if !admin.can(permission, quizOf(r)) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next(w, r)
+		}
+	}
+}
+
+// only lets the server's owner through, for routes that cover every organisation
+func requireServerOwner(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		admin, loggedIn := requestAdmin(r)
+		if !loggedIn {
+			refuseAdmin(w, r)
+			return
+		}
+		if !admin.isServerOwner() {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// handles POST /reset-group/{quiz}/, clears the scores for the posted group so it can play again
+func resetGroupHandler(w http.ResponseWriter, r *http.Request) {
+	quizId := quizFromPath(r)
+	group := r.PostFormValue("group")
+	responseText := `<p class="green">Reset {{ .Group }}, {{ .Removed }} contestants removed</p>`
+	removed, err := resetGroup(quizId, group)
+	if err != nil {
+		requestLogger(r).Error("Error resetting group", "quiz_id", quizId, "group", group, "error", err)
+		responseText = `<p class="error">There was a problem resetting {{ .Group }}</p>`
+	} else {
+		recordWebAudit(r, "group reset", quizId, fmt.Sprintf("group %s, %d contestants removed", group, removed))
+	}
+
+	tmpl, err := template.New("response").Parse(responseText)
+	if err != nil {
+		requestLogger(r).Error("Error rendering template", "error", err)
+		return
+	}
+	tmpl.Execute(w, map[string]interface{}{"Group": group, "Removed": removed})
+}
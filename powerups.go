@@ -0,0 +1,222 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strconv"
+)
+
+const (
+	jokerPowerup      = "joker"
+	fiftyFiftyPowerup = "fifty_fifty"
+)
+
+// what the contestant can still play and what they have already played on the current question
+type Powerups struct {
+	JokerAvailable      bool
+	JokerHere           bool
+	FiftyFiftyAvailable bool
+	FiftyFiftyHere      bool
+}
+
+type playedPowerup struct {
+	questionId int64
+	roundId    int64
+}
+
+// power-ups the contestant has played, keyed by power-up
+func getPlayedPowerups(contestantId string) (map[string]playedPowerup, error) {
+	result, err := makeDatabaseQuery("SELECT powerup, question_id, round_id FROM contestant_powerups WHERE contestant_id = ?", contestantId)
+	if err != nil {
+		return nil, err
+	}
+
+	played := map[string]playedPowerup{}
+	for _, row := range result {
+		var powerup playedPowerup
+		powerup.questionId, _ = row["question_id"].(int64)
+		powerup.roundId, _ = row["round_id"].(int64)
+		played[row["powerup"].(string)] = powerup
+	}
+	return played, nil
+}
+
+// each power-up can only be played once per quiz, returns false if it had already been played
+func playPowerup(contestantId string, powerup string, questionId int64, roundId int64) (bool, error) {
+	var question, round interface{}
+	if questionId != 0 {
+		question = questionId
+	}
+	if roundId != 0 {
+		round = roundId
+	}
+
+	db, err := openDatabase()
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec("INSERT OR IGNORE INTO contestant_powerups(contestant_id, powerup, question_id, round_id) VALUES (?, ?, ?, ?)", contestantId, powerup, question, round)
+	if err != nil {
+		return false, err
+	}
+	inserted, err := result.RowsAffected()
+	return inserted > 0, err
+}
+
+// true if the contestant has already answered any of the given question, or any question in the round
+func alreadyAnswered(contestantId string, questionId int64, roundId int64) (bool, error) {
+	result, err := makeDatabaseQuery("SELECT COUNT(*) AS answered FROM answers WHERE contestant_id = ? AND (question_id = ? OR round_id = ?)", contestantId, questionId, roundId)
+	if err != nil {
+		return false, err
+	}
+	return result[0]["answered"].(int64) > 0, nil
+}
+
+// the joker is played on a question along with its answer or on a round from its intro, either way before any of it has
+// been answered. Returns false if the contestant had already played it
+func playJoker(quizDetails Quiz, contestantId string, questionId int64, roundId int64) (bool, error) {
+	if !quizDetails.Jokers {
+		return false, errors.New("jokers aren't available in this quiz")
+	}
+	answered, err := alreadyAnswered(contestantId, questionId, roundId)
+	if err != nil {
+		return false, err
+	}
+	if answered {
+		return false, errors.New("the joker can't be played on something already answered")
+	}
+	return playPowerup(contestantId, jokerPowerup, questionId, roundId)
+}
+
+// works out the power-up controls for the question and takes away two wrong answers if the contestant played their
+// 50/50 on it. The answers removed are picked with the contestant's seed so they stay the same if the page is reloaded
+func applyPowerups(quizDetails Quiz, contestant Contestant, question *Question) Powerups {
+	var powerups Powerups
+	if !quizDetails.Jokers && !quizDetails.FiftyFifty {
+		return powerups
+	}
+
+	played, err := getPlayedPowerups(contestant.ContestantId)
+	if err != nil {
+		slog.Error("Error getting power-ups", "contestant_id", contestant.ContestantId, "error", err)
+		return powerups
+	}
+
+	joker, jokerPlayed := played[jokerPowerup]
+	powerups.JokerAvailable = quizDetails.Jokers && !jokerPlayed
+	powerups.JokerHere = jokerPlayed && (joker.questionId == question.QuestionId || (joker.roundId != 0 && joker.roundId == question.Round.RoundId))
+
+	fiftyFifty, fiftyFiftyPlayed := played[fiftyFiftyPowerup]
+	powerups.FiftyFiftyAvailable = quizDetails.FiftyFifty && !fiftyFiftyPlayed
+	powerups.FiftyFiftyHere = fiftyFiftyPlayed && fiftyFifty.questionId == question.QuestionId
+
+	if powerups.FiftyFiftyHere {
+		var wrong []int
+		for _, answer := range question.Answers {
+			if answer.Number != int(question.CorrectAnswer) && answer.Text != "" {
+				wrong = append(wrong, answer.Number)
+			}
+		}
+		shuffler := rand.New(rand.NewSource(contestant.Seed + question.QuestionId))
+		shuffler.Shuffle(len(wrong), func(i, j int) {
+			wrong[i], wrong[j] = wrong[j], wrong[i]
+		})
+
+		removed := map[int]bool{}
+		for i := 0; i < len(wrong) && i < 2; i++ {
+			removed[wrong[i]] = true
+		}
+		var remaining []Answer
+		for _, answer := range question.Answers {
+			if !removed[answer.Number] {
+				remaining = append(remaining, answer)
+			}
+		}
+		question.Answers = remaining
+	}
+
+	return powerups
+}
+
+// handles /fifty-fifty/, plays the contestant's 50/50 on the question they are answering and shows it again without two
+// of the wrong answers
+func fiftyFifty(w http.ResponseWriter, r *http.Request) {
+	contestantId := r.PostFormValue("contestant-id")
+	position, err := strconv.Atoi(r.PostFormValue("question"))
+	contestantDetails := getContestantDetails(r.Context(), contestantId)
+	if err != nil || contestantDetails.ContestantId == "" || !quizInRequestOrganisation(r, contestantDetails.QuizId) {
+		http.Error(w, "Missing question or contestant", http.StatusBadRequest)
+		return
+	}
+
+	if !quizOpenFor(contestantDetails) {
+		writeQuizClosed(w, r, contestantDetails.QuizId, contestantDetails.Group)
+		return
+	}
+
+	quizDetails, err := getQuiz(contestantDetails.QuizId)
+	if err != nil || !quizDetails.FiftyFifty {
+		http.Error(w, "50/50 isn't available in this quiz", http.StatusBadRequest)
+		return
+	}
+
+	// only the question being answered, not one already answered or still to come
+	if position != int(contestantDetails.QuestionsAnswered)+1 {
+		http.Error(w, "50/50 can only be played on the current question", http.StatusBadRequest)
+		return
+	}
+
+	_, retrievedQuestion := getQuestionDetails(contestantDetails.QuizId, contestantDetails, position)
+	if retrievedQuestion.QuestionId == 0 {
+		http.Error(w, "Question not found", http.StatusBadRequest)
+		return
+	}
+
+	translator := requestTranslator(r, contestantDetails.QuizId)
+	retrievedQuestion = translateQuestion(retrievedQuestion, translator.Locale)
+
+	played, err := playPowerup(contestantId, fiftyFiftyPowerup, retrievedQuestion.QuestionId, 0)
+	if err != nil {
+		requestLogger(r).Error("Error playing 50/50", "contestant_id", contestantId, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	powerups := applyPowerups(quizDetails, contestantDetails, &retrievedQuestion)
+	if !played && !powerups.FiftyFiftyHere {
+		http.Error(w, "50/50 has already been played", http.StatusBadRequest)
+		return
+	}
+	if !isHtmxRequest(r) {
+		http.Redirect(w, r, quizPageUrl(r, contestantDetails.QuizId), http.StatusSeeOther)
+		return
+	}
+
+	retrievedQuestion.SecondsLeft, retrievedQuestion.Timed, err = roundSecondsLeft(contestantId, retrievedQuestion.Round)
+	if err != nil {
+		requestLogger(r).Error("Error getting round timer", "contestant_id", contestantId, "error", err)
+	}
+
+	tmpl, err := pageTemplates.get("question")
+	if err != nil {
+		requestLogger(r).Error("Error rendering template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	err = tmpl.ExecuteTemplate(w, "question", map[string]interface{}{
+		"QuizId":     publicQuizId(contestantDetails.QuizId),
+		"OrgPath":    requestOrganisation(r).BasePath,
+		"Question":   retrievedQuestion,
+		"Contestant": contestantId,
+		"Group":      contestantDetails.Group,
+		"Powerups":   powerups,
+		"T":          translator,
+	})
+	if err != nil {
+		requestLogger(r).Error("Error rendering template", "error", err)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// requests a minute allowed by the player rate limits, set by the serve command's flags. 0 turns a limit off
+type RateLimits struct {
+	// registrations from one IP address, a whole office can share one so this allows a burst of a minute's worth
+	RegistrationsPerMinute int
+	// answers, next questions, 50:50s and integrity reports from one IP address
+	RequestsPerMinute int
+	// the same requests made as one contestant, whichever address they come from
+	ContestantRequestsPerMinute int
+}
+
+var rateLimits = RateLimits{
+	RegistrationsPerMinute:      60,
+	RequestsPerMinute:           600,
+	ContestantRequestsPerMinute: 60,
+}
+
+// a contestant gets through a burst of this many requests before being held to their per minute rate, enough for a
+// quick answer, 50:50 and next question without waiting
+const contestantBurst = 20
+
+// buckets that have filled back up are dropped this often so the maps don't grow forever
+const rateLimitSweepInterval = time.Minute
+
+// the header a proxy in front of the server puts the client's address in, e.g. Fly-Client-IP. Empty to use the
+// connection's address, only set it when every request comes through the proxy or the header can be forged
+var clientIpHeader string
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// a token bucket per key, each request takes a token and they refill at a steady rate up to the burst size
+type rateLimiter struct {
+	name      string
+	perSecond float64
+	burst     float64
+	now       func() time.Time
+
+	mutex     sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func newRateLimiter(name string, perMinute int, burst int) *rateLimiter {
+	return &rateLimiter{
+		name:      name,
+		perSecond: float64(perMinute) / 60,
+		burst:     float64(burst),
+		now:       time.Now,
+		buckets:   map[string]*tokenBucket{},
+	}
+}
+
+// takes a token for the key if there is one, otherwise says how long until there will be
+func (limiter *rateLimiter) allow(key string) (bool, time.Duration) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	now := limiter.now()
+	if now.Sub(limiter.lastSweep) >= rateLimitSweepInterval {
+		limiter.sweep(now)
+	}
+
+	bucket, found := limiter.buckets[key]
+	if !found {
+		bucket = &tokenBucket{tokens: limiter.burst, last: now}
+		limiter.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(limiter.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*limiter.perSecond)
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		wait := time.Duration((1 - bucket.tokens) / limiter.perSecond * float64(time.Second))
+		return false, wait
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// a full bucket is the same as no bucket, so forget them
+func (limiter *rateLimiter) sweep(now time.Time) {
+	for key, bucket := range limiter.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*limiter.perSecond >= limiter.burst {
+			delete(limiter.buckets, key)
+		}
+	}
+	limiter.lastSweep = now
+}
+
+// refuses requests with 429 Too Many Requests once the key's bucket is empty. Requests without a key, and every
+// request when the limiter is nil because the limit is off, are let through
+func rateLimited(limiter *rateLimiter, keyOf func(r *http.Request) string) middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			key := keyOf(r)
+			if limiter == nil || key == "" {
+				next(w, r)
+				return
+			}
+			if allowed, wait := limiter.allow(key); !allowed {
+				requestLogger(r).Warn("Rate limited", "limit", limiter.name, "key", key)
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+				return
+			}
+			next(w, r)
+		}
+	}
+}
+
+// nil when the limit is off
+func limiterFor(name string, perMinute int, burst int) *rateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	return newRateLimiter(name, perMinute, burst)
+}
+
+// the address the request came from, taken from clientIpHeader when it's set and present
+func clientIp(r *http.Request) string {
+	if clientIpHeader != "" {
+		if forwarded := r.Header.Get(clientIpHeader); forwarded != "" {
+			return forwarded
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// the contestant playing, from the form as the quiz pages post it or the cookie set when they registered
+func requestContestantId(r *http.Request) string {
+	if contestantId := r.PostFormValue("contestant-id"); contestantId != "" {
+		return contestantId
+	}
+	if cookie, err := r.Cookie("contestant-id"); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
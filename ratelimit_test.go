@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterRefills(t *testing.T) {
+	now := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	limiter := newRateLimiter("test", 60, 3)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if allowed, _ := limiter.allow("a"); !allowed {
+			t.Fatalf("request %d refused within the burst", i+1)
+		}
+	}
+	allowed, wait := limiter.allow("a")
+	if allowed || wait != time.Second {
+		t.Errorf("got %v waiting %v once the burst is used, want refused for 1s", allowed, wait)
+	}
+	// each key has its own bucket
+	if allowed, _ := limiter.allow("b"); !allowed {
+		t.Error("another key was refused")
+	}
+
+	now = now.Add(1500 * time.Millisecond)
+	if allowed, _ := limiter.allow("a"); !allowed {
+		t.Error("refused after a token refilled")
+	}
+	if allowed, _ := limiter.allow("a"); allowed {
+		t.Error("allowed before the next token refilled")
+	}
+
+	// buckets that have filled back up are forgotten
+	now = now.Add(time.Hour)
+	limiter.allow("c")
+	if len(limiter.buckets) != 1 {
+		t.Errorf("got %d buckets after the sweep, want only c", len(limiter.buckets))
+	}
+}
+
+func TestRateLimitedMiddleware(t *testing.T) {
+	handler := chain(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}, rateLimited(newRateLimiter("test", 1, 2), requestContestantId))
+
+	post := func(contestantId string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/record-answer/", nil)
+		req.PostForm = url.Values{"contestant-id": {contestantId}}
+		recorder := httptest.NewRecorder()
+		handler(recorder, req)
+		return recorder
+	}
+
+	post("rita")
+	post("rita")
+	refused := post("rita")
+	if refused.Code != http.StatusTooManyRequests || refused.Header().Get("Retry-After") != "60" {
+		t.Errorf("got status %d with Retry-After %q, want 429 and 60", refused.Code, refused.Header().Get("Retry-After"))
+	}
+	if status := post("sam").Code; status != http.StatusNoContent {
+		t.Errorf("another contestant got status %d", status)
+	}
+	// nothing to key on, e.g. a contestant who hasn't registered, isn't limited here
+	for i := 0; i < 5; i++ {
+		if status := post("").Code; status != http.StatusNoContent {
+			t.Fatalf("request without a contestant got status %d", status)
+		}
+	}
+}
+
+func TestClientIp(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.0.2.7:51234"
+	req.Header.Set("Fly-Client-IP", "198.51.100.9")
+
+	if ip := clientIp(req); ip != "192.0.2.7" {
+		t.Errorf("got %s, want the connection's address while the header isn't trusted", ip)
+	}
+
+	previous := clientIpHeader
+	clientIpHeader = "Fly-Client-IP"
+	t.Cleanup(func() { clientIpHeader = previous })
+	if ip := clientIp(req); ip != "198.51.100.9" {
+		t.Errorf("got %s, want the address from the proxy's header", ip)
+	}
+}
+
+func TestRegistrationsAreRateLimited(t *testing.T) {
+	useTestDatabase(t)
+	addTestQuiz(t, "limited", "Limited", arithmeticQuestions)
+	previous := rateLimits
+	rateLimits.RegistrationsPerMinute = 2
+	t.Cleanup(func() { rateLimits = previous })
+	server := newTestServer(t)
+
+	for i, name := range []string{"Ann", "Bob", "Cat"} {
+		status, _, _ := postForm(t, newTestClient(t), server.URL+"/limited/legal", url.Values{"contestant-name": {name}}, false)
+		if i < 2 && status != http.StatusFound {
+			t.Errorf("%s: got status %d, want registered", name, status)
+		}
+		if i == 2 && status != http.StatusTooManyRequests {
+			t.Errorf("%s: got status %d, want 429", name, status)
+		}
+	}
+	if contestants := countContestants(t, "limited"); contestants != 2 {
+		t.Errorf("got %d contestants, want 2", contestants)
+	}
+}
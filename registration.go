@@ -0,0 +1,203 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	maxContestantNameLength = 40
+	// the hidden field people never see or fill in, bots filling in every field do
+	honeypotField = "website"
+	// leading zero bits the proof of work's hash needs, around 16,000 tries, a moment for a browser
+	proofOfWorkBits = 14
+	// how long a registration page's challenge can be solved and used for
+	proofOfWorkLifetime = 10 * time.Minute
+)
+
+// names that could be mistaken for someone running the quiz
+var reservedNames = map[string]bool{
+	"admin":         true,
+	"administrator": true,
+	"host":          true,
+	"moderator":     true,
+	"organiser":     true,
+	"organizer":     true,
+	"owner":         true,
+	"quizmaster":    true,
+	"root":          true,
+	"system":        true,
+}
+
+// words that aren't allowed anywhere in a name, kept short as it only has to stop the obvious on a work scoreboard
+var blockedNameWords = []string{
+	"arse", "arsehole", "asshole", "bastard", "bitch", "bollocks", "cock", "cunt", "fuck", "fucker",
+	"fucking", "motherfucker", "nigger", "penis", "piss", "prick", "pussy", "shit", "slut", "twat", "wank",
+	"wanker", "whore",
+}
+
+// digits and symbols people swap in for letters to get past filters
+var lookalikeLetters = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s", "!", "i")
+
+// why a registration was turned down, the values are the home page's translation keys
+type registrationProblem string
+
+const (
+	nameLength     registrationProblem = "home.name_length"
+	nameNotAllowed registrationProblem = "home.name_not_allowed"
+	groupFull      registrationProblem = "home.group_full"
+	checkFailed    registrationProblem = "home.check_failed"
+)
+
+// the name with surrounding space trimmed, or why it can't be used
+func validateContestantName(name string) (string, registrationProblem) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxContestantNameLength {
+		return name, nameLength
+	}
+	for _, r := range name {
+		if !unicode.IsPrint(r) {
+			return name, nameNotAllowed
+		}
+	}
+
+	normalised := lookalikeLetters.Replace(strings.ToLower(name))
+	words := strings.FieldsFunc(normalised, func(r rune) bool { return !unicode.IsLetter(r) })
+	if reservedNames[strings.Join(words, "")] {
+		return name, nameNotAllowed
+	}
+	// whole words only, so Scunthorpe and Cockburn can play, but also the name run together to catch f.u.c.k
+	candidates := append(words, strings.Join(words, ""))
+	for _, candidate := range candidates {
+		for _, blocked := range blockedNameWords {
+			if candidate == blocked {
+				return name, nameNotAllowed
+			}
+		}
+	}
+	return name, ""
+}
+
+// checks a registration from the home page's form, returning the name to register under or why it was turned down
+func checkRegistration(r *http.Request, quizDetails Quiz, group string, now time.Time) (string, registrationProblem, error) {
+	if r.PostFormValue(honeypotField) != "" {
+		requestLogger(r).Warn("Registration filled in the honeypot", "quiz_id", quizDetails.quizId)
+		return "", checkFailed, nil
+	}
+	if quizDetails.ProofOfWork && !checkProofOfWork(quizDetails.quizId, group, r.PostFormValue("proof-of-work-challenge"), r.PostFormValue("proof-of-work-solution"), now) {
+		requestLogger(r).Warn("Registration failed the proof of work", "quiz_id", quizDetails.quizId)
+		return "", checkFailed, nil
+	}
+
+	name, problem := validateContestantName(r.PostFormValue("contestant-name"))
+	if problem != "" {
+		return name, problem, nil
+	}
+	full, err := groupIsFull(quizDetails, group, name)
+	if err != nil {
+		return name, "", err
+	}
+	if full {
+		return name, groupFull, nil
+	}
+	return name, "", nil
+}
+
+// whether the group already has as many contestants as the quiz allows. Someone registering again under a name that
+// is already in the group isn't adding to it
+func groupIsFull(quizDetails Quiz, group string, name string) (bool, error) {
+	if quizDetails.MaxGroupSize <= 0 {
+		return false, nil
+	}
+	result, err := makeDatabaseQuery("SELECT COUNT(*) AS contestants FROM scores WHERE quiz_id = ? AND `group` = ? AND name != ?",
+		quizDetails.quizId, strings.ToLower(group), name)
+	if err != nil {
+		return false, err
+	}
+	return result[0]["contestants"].(int64) >= quizDetails.MaxGroupSize, nil
+}
+
+// signs proof of work challenges so they can't be made up, a new key each time the server starts only means
+// registration pages open across a restart need reloading
+var proofOfWorkKey = func() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+// challenges that have been used, until they expire, so one solution can't register a crowd
+var spentChallenges = struct {
+	sync.Mutex
+	expires map[string]time.Time
+}{expires: map[string]time.Time{}}
+
+func proofOfWorkSignature(quizId string, group string, issued string, nonce string) string {
+	mac := hmac.New(sha256.New, proofOfWorkKey)
+	fmt.Fprintf(mac, "%s|%s|%s|%s", quizId, strings.ToLower(group), issued, nonce)
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// a challenge for the registration page, the time it was issued, a random nonce and a signature over both
+func newProofOfWorkChallenge(quizId string, group string, now time.Time) string {
+	nonceBytes := make([]byte, 12)
+	rand.Read(nonceBytes)
+	nonce := hex.EncodeToString(nonceBytes)
+	issued := strconv.FormatInt(now.Unix(), 10)
+	return issued + "." + nonce + "." + proofOfWorkSignature(quizId, group, issued, nonce)
+}
+
+// leading zero bits in the SHA-256 of the challenge and solution, as quiz.js counts them
+func proofOfWorkZeroBits(challenge string, solution string) int {
+	hash := sha256.Sum256([]byte(challenge + ":" + solution))
+	zeros := 0
+	for _, b := range hash {
+		zeros += bits.LeadingZeros8(b)
+		if b != 0 {
+			break
+		}
+	}
+	return zeros
+}
+
+// whether the solution solves a challenge issued for this quiz and group that is still in date and hasn't been used,
+// using it up if so
+func checkProofOfWork(quizId string, group string, challenge string, solution string, now time.Time) bool {
+	parts := strings.Split(challenge, ".")
+	if len(parts) != 3 || !hmac.Equal([]byte(parts[2]), []byte(proofOfWorkSignature(quizId, group, parts[0], parts[1]))) {
+		return false
+	}
+	issued, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return false
+	}
+	expires := time.Unix(issued, 0).Add(proofOfWorkLifetime)
+	if now.After(expires) || proofOfWorkZeroBits(challenge, solution) < proofOfWorkBits {
+		return false
+	}
+
+	spentChallenges.Lock()
+	defer spentChallenges.Unlock()
+	for spent, at := range spentChallenges.expires {
+		if now.After(at) {
+			delete(spentChallenges.expires, spent)
+		}
+	}
+	if _, spent := spentChallenges.expires[challenge]; spent {
+		return false
+	}
+	spentChallenges.expires[challenge] = expires
+	return true
+}
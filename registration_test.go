@@ -0,0 +1,154 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateContestantName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		problem registrationProblem
+	}{
+		{"  Rita  ", "Rita", ""},
+		{"Jean-Luc O'Neill", "Jean-Luc O'Neill", ""},
+		{"Scunthorpe United", "Scunthorpe United", ""},
+		{"Zoë", "Zoë", ""},
+		{"   ", "", nameLength},
+		{strings.Repeat("a", maxContestantNameLength), strings.Repeat("a", maxContestantNameLength), ""},
+		{strings.Repeat("é", maxContestantNameLength+1), strings.Repeat("é", maxContestantNameLength+1), nameLength},
+		{"Admin", "Admin", nameNotAllowed},
+		{"Quiz Master", "Quiz Master", nameNotAllowed},
+		{"4dm1n", "4dm1n", nameNotAllowed},
+		{"Big Sh1t", "Big Sh1t", nameNotAllowed},
+		{"f.u.c.k", "f.u.c.k", nameNotAllowed},
+		{"Tab\tName", "Tab\tName", nameNotAllowed},
+	}
+	for _, test := range tests {
+		name, problem := validateContestantName(test.name)
+		if name != test.want || problem != test.problem {
+			t.Errorf("validateContestantName(%q) = %q, %q, want %q, %q", test.name, name, problem, test.want, test.problem)
+		}
+	}
+}
+
+// brute forces the challenge as quiz.js does
+func solveProofOfWork(challenge string) string {
+	for solution := 0; ; solution++ {
+		if proofOfWorkZeroBits(challenge, strconv.Itoa(solution)) >= proofOfWorkBits {
+			return strconv.Itoa(solution)
+		}
+	}
+}
+
+func TestCheckProofOfWork(t *testing.T) {
+	now := time.Now()
+	challenge := newProofOfWorkChallenge("christmas", "legal", now)
+	solution := solveProofOfWork(challenge)
+
+	// one in 16,000 or so other numbers happen to work too
+	if wrong := solution + "0"; proofOfWorkZeroBits(challenge, wrong) < proofOfWorkBits && checkProofOfWork("christmas", "legal", challenge, wrong, now) {
+		t.Error("accepted a wrong solution")
+	}
+	if checkProofOfWork("christmas", "finance", challenge, solution, now) {
+		t.Error("accepted a challenge issued for another group")
+	}
+	if checkProofOfWork("christmas", "legal", challenge, solution, now.Add(proofOfWorkLifetime+time.Second)) {
+		t.Error("accepted an expired challenge")
+	}
+	forged := strings.Replace(challenge, strconv.FormatInt(now.Unix(), 10), strconv.FormatInt(now.Add(time.Hour).Unix(), 10), 1)
+	if checkProofOfWork("christmas", "legal", forged, solveProofOfWork(forged), now) {
+		t.Error("accepted a challenge with a changed time")
+	}
+	if !checkProofOfWork("christmas", "legal", challenge, solution, now) {
+		t.Fatal("refused the solved challenge")
+	}
+	if checkProofOfWork("christmas", "legal", challenge, solution, now) {
+		t.Error("accepted the same challenge twice")
+	}
+}
+
+func countContestants(t *testing.T, quizId string) int64 {
+	t.Helper()
+	rows, err := makeDatabaseQuery("SELECT COUNT(*) AS contestants FROM scores WHERE quiz_id = ?", quizId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows[0]["contestants"].(int64)
+}
+
+var challengeInput = regexp.MustCompile(`name="proof-of-work-challenge" value="([^"]+)"`)
+
+func TestRegistrationChecks(t *testing.T) {
+	useTestDatabase(t)
+	addTestQuiz(t, "checked", "Checked", arithmeticQuestions)
+	if err := updateQuiz("checked", map[string]interface{}{"max_group_size": 2}); err != nil {
+		t.Fatal(err)
+	}
+	server := newTestServer(t)
+
+	register := func(client *http.Client, values url.Values) (int, string) {
+		status, _, body := postForm(t, client, server.URL+"/checked/legal", values, false)
+		return status, body
+	}
+
+	_, body := register(newTestClient(t), url.Values{"contestant-name": {"Admin"}})
+	expectContains(t, "reserved name", body, "Please choose a different name.", `value="Admin"`)
+	_, body = register(newTestClient(t), url.Values{"contestant-name": {"Bot"}, honeypotField: {"http://spam.example.com"}})
+	expectContains(t, "honeypot", body, "check you&#39;re a person")
+
+	for _, name := range []string{"Ann", "Bob"} {
+		if status, _ := register(newTestClient(t), url.Values{"contestant-name": {name}}); status != http.StatusFound {
+			t.Fatalf("%s: got status %d, want registered", name, status)
+		}
+	}
+	_, body = register(newTestClient(t), url.Values{"contestant-name": {"Cat"}})
+	expectContains(t, "full group", body, "This group is full")
+	// coming back to carry on under a name already in the group is still fine
+	if status, _ := register(newTestClient(t), url.Values{"contestant-name": {"Ann"}}); status != http.StatusFound {
+		t.Errorf("Ann registering again got status %d", status)
+	}
+	if contestants := countContestants(t, "checked"); contestants != 2 {
+		t.Errorf("got %d contestants, want the 2 the group allows", contestants)
+	}
+
+	if err := updateQuiz("checked", map[string]interface{}{"max_group_size": 0, "proof_of_work": 1}); err != nil {
+		t.Fatal(err)
+	}
+	client := newTestClient(t)
+	_, _, page := get(t, client, server.URL+"/checked/legal")
+	expectContains(t, "proof of work form", page, `data-proof-of-work="14"`, "<noscript>")
+	challenge := challengeInput.FindStringSubmatch(page)
+	if challenge == nil {
+		t.Fatal("no challenge on the registration page")
+	}
+
+	_, body = register(client, url.Values{"contestant-name": {"Dan"}})
+	expectContains(t, "unsolved", body, "check you&#39;re a person")
+	solved := url.Values{"contestant-name": {"Dan"}, "proof-of-work-challenge": {challenge[1]}, "proof-of-work-solution": {solveProofOfWork(challenge[1])}}
+	if status, _ := register(client, solved); status != http.StatusFound {
+		t.Errorf("solved: got status %d, want registered", status)
+	}
+	solved.Set("contestant-name", "Eve")
+	if status, _ := register(client, solved); status == http.StatusFound {
+		t.Error("the same solution registered a second contestant")
+	}
+}
+
+func TestGroupsHaveNoSizeLimitByDefault(t *testing.T) {
+	useTestDatabase(t)
+	addTestQuiz(t, "unlimited", "Unlimited", arithmeticQuestions)
+	quizDetails, err := getQuiz("unlimited")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quizDetails.MaxGroupSize != 0 {
+		t.Errorf("got a limit of %d contestants in each group, want none", quizDetails.MaxGroupSize)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Round struct {
+	RoundId    int64
+	QuizId     string
+	Title      string
+	Intro      string
+	SortOrder  int64
+	TimeLimit  int64
+	Multiplier float64
+}
+
+type RoundScore struct {
+	Title   string  `json:"title"`
+	Correct int64   `json:"correct_answers"`
+	Points  float64 `json:"points"`
+}
+
+// answers submitted this many seconds after the round timer runs out still count, to allow for the request in flight
+const roundGraceSeconds = 2
+
+// round settings that can be changed after creation, mapped to the flag used to change them
+var roundSettings = map[string]string{
+	"title":              "title",
+	"intro":              "intro",
+	"sort_order":         "sort-order",
+	"time_limit_seconds": "time-limit",
+	"multiplier":         "multiplier",
+}
+
+func validateRoundSetting(column string, value string) error {
+	switch column {
+	case "title":
+		if strings.TrimSpace(value) == "" {
+			return errors.New("round title can't be empty")
+		}
+	case "sort_order":
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("sort order must be a number, got %q", value)
+		}
+	case "time_limit_seconds":
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			return fmt.Errorf("time limit must be 0 (no limit) or more seconds, got %q", value)
+		}
+	case "multiplier":
+		multiplier, err := strconv.ParseFloat(value, 64)
+		if err != nil || multiplier < 0 {
+			return fmt.Errorf("multiplier must be 0 or more, got %q", value)
+		}
+	}
+	return nil
+}
+
+func roundFromRow(row map[string]interface{}) Round {
+	return Round{
+		RoundId:    row["round_id"].(int64),
+		QuizId:     row["quiz_id"].(string),
+		Title:      row["title"].(string),
+		Intro:      row["intro"].(string),
+		SortOrder:  row["sort_order"].(int64),
+		TimeLimit:  row["time_limit_seconds"].(int64),
+		Multiplier: row["multiplier"].(float64),
+	}
+}
+
+func listRounds(quizId string) ([]Round, error) {
+	result, err := makeDatabaseQuery("SELECT * FROM rounds WHERE quiz_id = ? ORDER BY sort_order, round_id", quizId)
+	if err != nil {
+		return nil, err
+	}
+
+	var rounds []Round
+	for _, row := range result {
+		rounds = append(rounds, roundFromRow(row))
+	}
+	return rounds, nil
+}
+
+func addRound(round Round) (int64, error) {
+	db, err := openDatabase()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec("INSERT INTO rounds(quiz_id, title, intro, sort_order, time_limit_seconds, multiplier) VALUES (?, ?, ?, ?, ?, ?)",
+		round.QuizId, round.Title, round.Intro, round.SortOrder, round.TimeLimit, round.Multiplier)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// changes maps column names to their new values, only known round settings are accepted
+func updateRound(roundId int64, changes map[string]interface{}) error {
+	var columns []string
+	for column := range changes {
+		if _, found := roundSettings[column]; !found {
+			return fmt.Errorf("unknown round setting %s", column)
+		}
+		columns = append(columns, column)
+	}
+	if len(columns) == 0 {
+		return errors.New("no changes to apply")
+	}
+	sort.Strings(columns)
+
+	var setClauses []string
+	var args []interface{}
+	for _, column := range columns {
+		setClauses = append(setClauses, column+" = ?")
+		args = append(args, changes[column])
+	}
+	args = append(args, roundId)
+
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	result, err := db.Exec("UPDATE rounds SET "+strings.Join(setClauses, ", ")+" WHERE round_id = ?", args...)
+	if err != nil {
+		return err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return fmt.Errorf("no round found with ID %d", roundId)
+	}
+
+	return nil
+}
+
+// removes the round, its questions stay in the quiz without a round
+func deleteRound(roundId int64) error {
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM rounds WHERE round_id = ?", roundId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		tx.Rollback()
+		return fmt.Errorf("no round found with ID %d", roundId)
+	}
+
+	for _, query := range []string{
+		"UPDATE quiz_questions SET round_id = NULL WHERE round_id = ?",
+		"DELETE FROM contestant_rounds WHERE round_id = ?",
+	} {
+		if _, err := tx.Exec(query, roundId); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func roundInQuiz(quizId string, roundId interface{}) (bool, error) {
+	result, err := makeDatabaseQuery("SELECT COUNT(*) AS found FROM rounds WHERE quiz_id = ? AND round_id = ?", quizId, roundId)
+	if err != nil {
+		return false, err
+	}
+	return result[0]["found"].(int64) > 0, nil
+}
+
+// the round each question in the quiz belongs to, questions not in a round are left out
+func getQuestionRounds(quizId string) (map[int64]Round, error) {
+	result, err := makeDatabaseQuery(`SELECT quiz_questions.question_id, rounds.*
+		FROM quiz_questions
+		INNER JOIN rounds ON rounds.round_id = quiz_questions.round_id
+		WHERE quiz_questions.quiz_id = ?`, quizId)
+	if err != nil {
+		return nil, err
+	}
+
+	questionRounds := map[int64]Round{}
+	for _, row := range result {
+		questionRounds[row["question_id"].(int64)] = roundFromRow(row)
+	}
+	return questionRounds, nil
+}
+
+// keeps each round's questions together, in round order, questions not in a round come first. When shuffling only the
+// questions within a round are moved so the rounds stay in order
+func orderByRound(questionIds []int64, questionRounds map[int64]Round, shuffle bool, shuffler *rand.Rand) {
+	sort.SliceStable(questionIds, func(i, j int) bool {
+		first, second := questionRounds[questionIds[i]], questionRounds[questionIds[j]]
+		if first.SortOrder == second.SortOrder {
+			return first.RoundId < second.RoundId
+		}
+		return first.SortOrder < second.SortOrder
+	})
+
+	if !shuffle {
+		return
+	}
+	for start := 0; start < len(questionIds); {
+		end := start + 1
+		for end < len(questionIds) && questionRounds[questionIds[end]].RoundId == questionRounds[questionIds[start]].RoundId {
+			end++
+		}
+		segment := questionIds[start:end]
+		shuffler.Shuffle(len(segment), func(i, j int) {
+			segment[i], segment[j] = segment[j], segment[i]
+		})
+		start = end
+	}
+}
+
+// records when the contestant reached the round, the first time only so reloading doesn't restart the timer
+func startRound(contestantId string, roundId int64) error {
+	_, err := makeDatabaseQuery("INSERT OR IGNORE INTO contestant_rounds(contestant_id, round_id, started) VALUES (?, ?, STRFTIME('%Y-%m-%d %H:%M:%f', 'now'))", contestantId, roundId)
+	return err
+}
+
+// seconds left on the round timer for the contestant, negative once it has run out. Rounds without a limit report
+// false. The timer starts when the round's first question is shown, so a timed round the contestant was never shown has
+// already run out for them, otherwise answering it straight from a script would skip the timer
+func roundSecondsLeft(contestantId string, round Round) (int64, bool, error) {
+	if round.RoundId == 0 || round.TimeLimit == 0 {
+		return 0, false, nil
+	}
+
+	result, err := makeDatabaseQuery(`SELECT CAST(ROUND(? - (JULIANDAY('now') - JULIANDAY(started)) * 86400) AS INTEGER) AS seconds_left
+		FROM contestant_rounds WHERE contestant_id = ? AND round_id = ?`, round.TimeLimit, contestantId, round.RoundId)
+	if err != nil {
+		return 0, false, err
+	}
+	if len(result) == 0 {
+		return -roundGraceSeconds - 1, true, nil
+	}
+	return result[0]["seconds_left"].(int64), true, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// wraps a handler to run checks before it, e.g. that the quiz in the URL exists
+type middleware func(next http.HandlerFunc) http.HandlerFunc
+
+// applies the middleware in the order given, so the first one listed runs first
+func chain(handler http.HandlerFunc, middlewares ...middleware) http.HandlerFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// the stored quiz ID and group from the {quiz} and {group} parts of the request's route
+func requestQuiz(r *http.Request) (string, string) {
+	quizId := r.PathValue("quiz")
+	if strings.Contains(quizId, orgQuizSeparator) {
+		return "", r.PathValue("group")
+	}
+	return scopedQuizId(requestOrganisation(r).OrgId, quizId), r.PathValue("group")
+}
+
+// 404s for quizzes that don't exist in the request's organisation
+func knownQuiz(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		quizId, _ := requestQuiz(r)
+		exists, err := quizExists(quizId)
+		if err != nil {
+			requestLogger(r).Error("Error checking quiz", "quiz_id", quizId, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// 404s for groups nobody has joined, only for pages that show an existing group rather than letting people join one
+func knownGroup(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		quizId, group := requestQuiz(r)
+		exists, err := groupExists(quizId, group)
+		if err != nil {
+			requestLogger(r).Error("Error checking group", "quiz_id", quizId, "group", group, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// htmx asks for the part of the page it swaps in, plain form posts get a redirect to the whole page instead
+func isHtmxRequest(r *http.Request) bool {
+	return r.Header.Get("HX-Request") == "true"
+}
+
+// the page a contestant plays the quiz on, which carries on from their next unanswered question
+func quizPageUrl(r *http.Request, quizId string) string {
+	return requestOrganisation(r).BasePath + "/quiz/" + publicQuizId(quizId) + "/"
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+type poolQuestion struct {
+	questionId int64
+	stratum    string
+}
+
+var sampleStrata = []string{"", "tag", "difficulty"}
+
+func validateSampleStratify(stratify string) error {
+	for _, allowed := range sampleStrata {
+		if stratify == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("sample stratify must be tag, difficulty or empty, got %q", stratify)
+}
+
+// active questions for the quiz in sort order, each labelled with the stratum it is sampled from, questions with
+// several tags belong to their first tag alphabetically
+func getQuestionPool(quizDetails Quiz) ([]poolQuestion, error) {
+	poolQuery := `SELECT quiz_questions.question_id, questions.difficulty,
+		COALESCE((SELECT MIN(tag) FROM question_tags WHERE question_tags.question_id = quiz_questions.question_id), '') AS first_tag
+		FROM quiz_questions
+		INNER JOIN questions ON questions.question_id = quiz_questions.question_id
+		WHERE quiz_questions.quiz_id = ? AND quiz_questions.active = 1
+		ORDER BY quiz_questions.sort_order, quiz_questions.question_id`
+	result, err := makeDatabaseQuery(poolQuery, quizDetails.quizId)
+	if err != nil {
+		return nil, err
+	}
+
+	var pool []poolQuestion
+	for _, row := range result {
+		question := poolQuestion{questionId: row["question_id"].(int64)}
+		switch quizDetails.SampleStratify {
+		case "tag":
+			question.stratum = row["first_tag"].(string)
+		case "difficulty":
+			question.stratum = row["difficulty"].(string)
+		}
+		pool = append(pool, question)
+	}
+
+	return pool, nil
+}
+
+// draws sampleSize questions from the pool, keeping them in pool order. When the pool is split into strata each one gets a
+// share of the sample proportional to its size (largest remainder first) so every stratum stays represented
+func sampleQuestions(pool []poolQuestion, sampleSize int, shuffler *rand.Rand) []int64 {
+	if sampleSize <= 0 || sampleSize >= len(pool) {
+		var questionIds []int64
+		for _, question := range pool {
+			questionIds = append(questionIds, question.questionId)
+		}
+		return questionIds
+	}
+
+	strata := map[string][]int{}
+	var strataNames []string
+	for i, question := range pool {
+		if _, found := strata[question.stratum]; !found {
+			strataNames = append(strataNames, question.stratum)
+		}
+		strata[question.stratum] = append(strata[question.stratum], i)
+	}
+	sort.Strings(strataNames)
+
+	quotas := map[string]int{}
+	remainders := map[string]float64{}
+	allocated := 0
+	for _, name := range strataNames {
+		exact := float64(sampleSize) * float64(len(strata[name])) / float64(len(pool))
+		quotas[name] = int(exact)
+		remainders[name] = exact - float64(quotas[name])
+		allocated += quotas[name]
+	}
+	byRemainder := append([]string(nil), strataNames...)
+	sort.SliceStable(byRemainder, func(i, j int) bool {
+		return remainders[byRemainder[i]] > remainders[byRemainder[j]]
+	})
+	for i := 0; allocated < sampleSize; i++ {
+		quotas[byRemainder[i%len(byRemainder)]]++
+		allocated++
+	}
+
+	var chosen []int
+	for _, name := range strataNames {
+		members := append([]int(nil), strata[name]...)
+		shuffler.Shuffle(len(members), func(i, j int) {
+			members[i], members[j] = members[j], members[i]
+		})
+		chosen = append(chosen, members[:quotas[name]]...)
+	}
+	sort.Ints(chosen)
+
+	var questionIds []int64
+	for _, index := range chosen {
+		questionIds = append(questionIds, pool[index].questionId)
+	}
+	return questionIds
+}
+
+func getAssignedQuestions(contestantId string) ([]int64, error) {
+	result, err := makeDatabaseQuery("SELECT question_id FROM contestant_questions WHERE contestant_id = ? ORDER BY position", contestantId)
+	if err != nil {
+		return nil, err
+	}
+
+	var questionIds []int64
+	for _, row := range result {
+		questionIds = append(questionIds, row["question_id"].(int64))
+	}
+	return questionIds, nil
+}
+
+func saveAssignedQuestions(contestantId string, questionIds []int64) error {
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// the set is derived from the contestant's seed, so if another request got there first it saved the same questions
+	for position, questionId := range questionIds {
+		_, err := tx.Exec("INSERT OR IGNORE INTO contestant_questions(contestant_id, position, question_id) VALUES (?, ?, ?)", contestantId, position+1, questionId)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
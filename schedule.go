@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// when a quiz (or one group playing it) can be played, a zero time means no limit
+type Schedule struct {
+	OpensAt  time.Time
+	ClosesAt time.Time
+}
+
+// schedule times are stored in UTC in the same format SQLite's DATETIME uses
+const scheduleTimeFormat = "2006-01-02 15:04:05"
+
+// formats accepted on the command line, times without a zone are in the server's local time
+var scheduleInputFormats = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+func (schedule Schedule) NotOpenYet(now time.Time) bool {
+	return !schedule.OpensAt.IsZero() && now.Before(schedule.OpensAt)
+}
+
+func (schedule Schedule) Closed(now time.Time) bool {
+	return !schedule.ClosesAt.IsZero() && !now.Before(schedule.ClosesAt)
+}
+
+func (schedule Schedule) Open(now time.Time) bool {
+	return !schedule.NotOpenYet(now) && !schedule.Closed(now)
+}
+
+// converts a time entered by an admin into the stored format, an empty value clears it
+func parseScheduleTime(value string) (interface{}, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	for _, format := range scheduleInputFormats {
+		if parsed, err := time.ParseInLocation(format, value, time.Local); err == nil {
+			return parsed.UTC().Format(scheduleTimeFormat), nil
+		}
+	}
+	return nil, fmt.Errorf("can't read %q as a time, use YYYY-MM-DD HH:MM or RFC 3339", value)
+}
+
+func scheduleTimeFromRow(value interface{}) time.Time {
+	stored, ok := value.(string)
+	if !ok {
+		return time.Time{}
+	}
+	parsed, err := time.Parse(scheduleTimeFormat, stored)
+	if err != nil {
+		return time.Time{}
+	}
+	return parsed
+}
+
+// the schedule for a group, times set for the group take the place of the quiz's own
+func getSchedule(quizId string, group string) (Schedule, error) {
+	var schedule Schedule
+
+	result, err := makeDatabaseQuery(`SELECT COALESCE(group_schedules.opens_at, quizzes.opens_at) AS opens_at,
+		COALESCE(group_schedules.closes_at, quizzes.closes_at) AS closes_at
+		FROM quizzes
+		LEFT JOIN group_schedules ON group_schedules.quiz_id = quizzes.quiz_id AND group_schedules."group" = ?
+		WHERE quizzes.quiz_id = ?`, strings.ToLower(group), quizId)
+	if err != nil || len(result) == 0 {
+		return schedule, err
+	}
+
+	schedule.OpensAt = scheduleTimeFromRow(result[0]["opens_at"])
+	schedule.ClosesAt = scheduleTimeFromRow(result[0]["closes_at"])
+	return schedule, nil
+}
+
+// changes maps opens_at and/or closes_at to their new stored values, for the whole quiz if group is empty
+func setSchedule(quizId string, group string, changes map[string]interface{}) error {
+	var setClauses []string
+	var args []interface{}
+	for _, column := range []string{"closes_at", "opens_at"} {
+		if value, found := changes[column]; found {
+			setClauses = append(setClauses, column+" = ?")
+			args = append(args, value)
+		}
+	}
+	if len(setClauses) == 0 {
+		return errors.New("no changes to apply")
+	}
+
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if group == "" {
+		result, err := db.Exec("UPDATE quizzes SET "+strings.Join(setClauses, ", ")+" WHERE quiz_id = ?", append(args, quizId)...)
+		if err != nil {
+			return err
+		}
+		if updated, _ := result.RowsAffected(); updated == 0 {
+			return fmt.Errorf("no quiz found with ID %s", quizId)
+		}
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO group_schedules(quiz_id, "group") VALUES (?, ?) ON CONFLICT DO NOTHING`, quizId, strings.ToLower(group))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("UPDATE group_schedules SET "+strings.Join(setClauses, ", ")+` WHERE quiz_id = ? AND "group" = ?`, append(args, quizId, strings.ToLower(group))...)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// contestants can only play while their group's quiz is open
+func quizOpenFor(contestant Contestant) bool {
+	schedule, err := getSchedule(contestant.QuizId, contestant.Group)
+	if err != nil {
+		slog.Error("Error getting schedule", "quiz_id", contestant.QuizId, "error", err)
+		return true
+	}
+	return schedule.Open(time.Now().UTC())
+}
+
+// shown in place of the next question when the quiz closes part way through, without htmx the contestant is sent to
+// the final scores
+func writeQuizClosed(w http.ResponseWriter, r *http.Request, quizId string, group string) {
+	if !isHtmxRequest(r) {
+		http.Redirect(w, r, fmt.Sprintf("%s/scoreboard/%s/%s/", requestOrganisation(r).BasePath, publicQuizId(quizId), group), http.StatusSeeOther)
+		return
+	}
+	tmpl, err := template.New("closed").Parse(`<p class="error">{{ .T.Text "closed.message" }}</p>
+		<p><a href="{{ .OrgPath }}/scoreboard/{{ .QuizId }}/{{ .Group }}/">{{ .T.Text "closed.final_scores" }}</a></p>`)
+	if err != nil {
+		requestLogger(r).Error("Error rendering template", "error", err)
+		return
+	}
+	tmpl.Execute(w, map[string]interface{}{
+		"QuizId":  publicQuizId(quizId),
+		"Group":   group,
+		"OrgPath": requestOrganisation(r).BasePath,
+		"T":       requestTranslator(r, quizId),
+	})
+}
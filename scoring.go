@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// one answer as the scorer sees it, points is what the question is worth (its value times the round multiplier) when
+// answered correctly
+type scoredAnswer struct {
+	questionId int64
+	roundId    int64
+	correct    bool
+	points     float64
+	timeTaken  float64
+	timed      bool
+	joker      bool
+}
+
+// each rule adds to (or takes away from) the score for every answer, in the order the contestant gave them, so the
+// points can be broken down by round as well as totalled
+type scoringRule interface {
+	apply(answers []scoredAnswer) []float64
+}
+
+type basePoints struct{}
+
+func (basePoints) apply(answers []scoredAnswer) []float64 {
+	points := make([]float64, len(answers))
+	for i, answer := range answers {
+		if answer.correct {
+			points[i] = answer.points
+		}
+	}
+	return points
+}
+
+type negativeMarking struct {
+	penalty float64
+}
+
+func (rule negativeMarking) apply(answers []scoredAnswer) []float64 {
+	points := make([]float64, len(answers))
+	for i, answer := range answers {
+		if !answer.correct {
+			points[i] = -rule.penalty
+		}
+	}
+	return points
+}
+
+// correct answers earn up to the full bonus, shrinking to nothing once the answer took the whole window
+type speedBonus struct {
+	bonus   float64
+	seconds float64
+}
+
+func (rule speedBonus) apply(answers []scoredAnswer) []float64 {
+	points := make([]float64, len(answers))
+	for i, answer := range answers {
+		if answer.correct && answer.timed && answer.timeTaken < rule.seconds {
+			points[i] = rule.bonus * (1 - answer.timeTaken/rule.seconds)
+		}
+	}
+	return points
+}
+
+// every correct answer that extends a run of correct answers earns the bonus
+type streakBonus struct {
+	bonus float64
+}
+
+func (rule streakBonus) apply(answers []scoredAnswer) []float64 {
+	points := make([]float64, len(answers))
+	for i, answer := range answers {
+		if i > 0 && answer.correct && answers[i-1].correct {
+			points[i] = rule.bonus
+		}
+	}
+	return points
+}
+
+// answers covered by the contestant's joker score their points twice
+type jokerBonus struct{}
+
+func (jokerBonus) apply(answers []scoredAnswer) []float64 {
+	points := make([]float64, len(answers))
+	for i, answer := range answers {
+		if answer.correct && answer.joker {
+			points[i] = answer.points
+		}
+	}
+	return points
+}
+
+// decides the order of contestants on the same score, negative if first should be placed ahead of second
+type tieBreaker func(quiz Quiz, first Score, second Score) int
+
+// the lower value goes first
+func compareLowest(first float64, second float64) int {
+	switch {
+	case first < second:
+		return -1
+	case first > second:
+		return 1
+	}
+	return 0
+}
+
+var tieBreakers = map[string]tieBreaker{
+	"time": func(quiz Quiz, first Score, second Score) int {
+		return compareLowest(float64(first.TimeTakenSeconds), float64(second.TimeTakenSeconds))
+	},
+	"last_answer": func(quiz Quiz, first Score, second Score) int {
+		return compareLowest(first.lastAnswerSeconds, second.lastAnswerSeconds)
+	},
+	// closest to the estimate question's answer, contestants who didn't give one go last
+	"estimate": func(quiz Quiz, first Score, second Score) int {
+		distance := func(score Score) float64 {
+			if score.Estimate == nil {
+				return math.Inf(1)
+			}
+			return math.Abs(*score.Estimate - quiz.EstimateAnswer)
+		}
+		return compareLowest(distance(first), distance(second))
+	},
+}
+
+func validateTieBreaker(name string) error {
+	if _, found := tieBreakers[name]; found {
+		return nil
+	}
+	var names []string
+	for name := range tieBreakers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("tie breaker must be one of %s, got %q", strings.Join(names, ", "), name)
+}
+
+type Scorer struct {
+	quiz       Quiz
+	rules      []scoringRule
+	tieBreaker tieBreaker
+}
+
+// builds the scorer for the quiz from its scoring settings, rules that are switched off are left out
+func newScorer(quiz Quiz) Scorer {
+	scorer := Scorer{
+		quiz:       quiz,
+		rules:      []scoringRule{basePoints{}, jokerBonus{}},
+		tieBreaker: tieBreakers["time"],
+	}
+	if quiz.NegativeMarking > 0 {
+		scorer.rules = append(scorer.rules, negativeMarking{penalty: quiz.NegativeMarking})
+	}
+	if quiz.SpeedBonus > 0 && quiz.SpeedBonusSeconds > 0 {
+		scorer.rules = append(scorer.rules, speedBonus{bonus: quiz.SpeedBonus, seconds: float64(quiz.SpeedBonusSeconds)})
+	}
+	if quiz.StreakBonus > 0 {
+		scorer.rules = append(scorer.rules, streakBonus{bonus: quiz.StreakBonus})
+	}
+	if breaker, found := tieBreakers[quiz.TieBreaker]; found {
+		scorer.tieBreaker = breaker
+	}
+	return scorer
+}
+
+// points for each answer with every rule applied, rounded to two decimal places
+func (scorer Scorer) answerPoints(answers []scoredAnswer) []float64 {
+	total := make([]float64, len(answers))
+	for _, rule := range scorer.rules {
+		for i, points := range rule.apply(answers) {
+			total[i] += points
+		}
+	}
+	for i := range total {
+		total[i] = math.Round(total[i]*100) / 100
+	}
+	return total
+}
+
+// fills in the points, percentage and per round breakdown for a contestant from their answers
+func (scorer Scorer) score(score *Score, answers []scoredAnswer, rounds []Round) {
+	// contestants who finished before answers were recorded individually score a point per correct answer
+	if len(answers) == 0 {
+		score.Points = float64(score.CorrectAnswers)
+	}
+
+	roundPoints := map[int64]float64{}
+	roundCorrect := map[int64]int64{}
+	for i, points := range scorer.answerPoints(answers) {
+		score.Points += points
+		roundPoints[answers[i].roundId] += points
+		if answers[i].correct {
+			roundCorrect[answers[i].roundId]++
+		}
+	}
+	score.Points = math.Round((score.Points-score.Penalty)*100) / 100
+
+	for _, round := range rounds {
+		score.Rounds = append(score.Rounds, RoundScore{
+			Title:   round.Title,
+			Correct: roundCorrect[round.RoundId],
+			Points:  math.Round(roundPoints[round.RoundId]*100) / 100,
+		})
+	}
+
+	score.lastAnswerSeconds = math.Inf(1)
+	if len(answers) > 0 && answers[len(answers)-1].timed {
+		score.lastAnswerSeconds = answers[len(answers)-1].timeTaken
+	}
+	if score.MaxPoints > 0 {
+		score.Percent = score.Points * 100 / score.MaxPoints
+	}
+}
+
+// negative if first should be placed ahead of second, 0 if they are tied on everything
+func (scorer Scorer) compare(first Score, second Score) int {
+	if first.Percent != second.Percent {
+		if first.Percent > second.Percent {
+			return -1
+		}
+		return 1
+	}
+	if result := scorer.tieBreaker(scorer.quiz, first, second); result != 0 {
+		return result
+	}
+	return tieBreakers["time"](scorer.quiz, first, second)
+}
+
+func (scorer Scorer) rank(scores []Score) {
+	sort.SliceStable(scores, func(i, j int) bool {
+		return scorer.compare(scores[i], scores[j]) < 0
+	})
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// htmx is vendored rather than loaded from a CDN, run go generate to fetch the pinned version into static/
+//go:generate curl -sSfL -o static/htmx.min.js https://unpkg.com/htmx.org@1.9.9/dist/htmx.min.js
+
+//go:embed static
+var embeddedStatic embed.FS
+
+// the files under static/, a variable so the tests can check what happens when one is missing
+var staticFiles fs.FS = func() fs.FS {
+	files, err := fs.Sub(embeddedStatic, "static")
+	if err != nil {
+		panic(err)
+	}
+	return files
+}()
+
+// files the pages can't work without, the server won't start until they have been added to static/
+var requiredAssets = []string{"htmx.min.js"}
+
+// asset URLs include a hash of the file so they can be cached forever, a changed file gets a new URL
+const staticCacheControl = "public, max-age=31536000, immutable"
+
+type staticAsset struct {
+	content     []byte
+	contentType string
+}
+
+// the files served under /static/, by the fingerprinted name they are served as
+type StaticAssets struct {
+	urls  map[string]string
+	files map[string]staticAsset
+}
+
+var staticAssets *StaticAssets
+
+// quiz.css is served as quiz.<first 8 bytes of its sha256>.css
+func fingerprintedName(name string, content []byte) string {
+	sum := sha256.Sum256(content)
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(sum[:8]) + ext
+}
+
+func loadStaticAssets() (*StaticAssets, error) {
+	files := staticFiles
+	entries, err := fs.ReadDir(files, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	assets := &StaticAssets{urls: map[string]string{}, files: map[string]staticAsset{}}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		content, err := fs.ReadFile(files, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("reading static file %s: %w", entry.Name(), err)
+		}
+		served := fingerprintedName(entry.Name(), content)
+		assets.urls[entry.Name()] = "/static/" + served
+		assets.files[served] = staticAsset{content: content, contentType: mime.TypeByExtension(path.Ext(entry.Name()))}
+	}
+
+	for _, name := range requiredAssets {
+		if _, found := assets.urls[name]; !found {
+			return nil, fmt.Errorf("static/%s is missing, run go generate to vendor it before building", name)
+		}
+	}
+	return assets, nil
+}
+
+// the URL to load a file in static/ from, used by the templates as {{ asset "quiz.css" }}
+func assetPath(name string) (string, error) {
+	if staticAssets == nil {
+		return "", fmt.Errorf("static assets haven't been loaded")
+	}
+	assetUrl, found := staticAssets.urls[name]
+	if !found {
+		return "", fmt.Errorf("no static file %s", name)
+	}
+	return assetUrl, nil
+}
+
+// handles GET /static/{file}, only the fingerprinted names are served
+func staticHandler(w http.ResponseWriter, r *http.Request) {
+	asset, found := staticAssets.files[r.PathValue("file")]
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	if asset.contentType != "" {
+		w.Header().Set("Content-Type", asset.contentType)
+	}
+	w.Header().Set("Cache-Control", staticCacheControl)
+	w.Write(asset.content)
+}
+
+func (assets *StaticAssets) contentSecurityPolicy() string {
+	return strings.Join([]string{
+		"default-src 'self'",
+		"script-src 'self'",
+		"style-src 'self'",
+		// quiz themes can use logos and background images from other sites
+		"img-src 'self' data: https:",
+		"connect-src 'self'",
+		"object-src 'none'",
+		"base-uri 'self'",
+		"form-action 'self'",
+		"frame-ancestors 'none'",
+	}, "; ")
+}
+
+// adds the security headers to every response, pages have no inline scripts or styles so the policy doesn't need
+// to allow any
+func securityHeaders(next http.Handler) http.Handler {
+	policy := staticAssets.contentSecurityPolicy()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", policy)
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Referrer-Policy", "same-origin")
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,124 @@
+// counts down any timers on the page, the deadline is fixed the first time each timer is seen. Timers marked
+// with data-reload refresh the page when they run out
+function formatCountdown(remaining) {
+    var days = Math.floor(remaining / 86400);
+    var hours = Math.floor(remaining / 3600) % 24;
+    var minutes = Math.floor(remaining / 60) % 60;
+    var clock = String(minutes).padStart(hours || days ? 2 : 1, '0') + ':' + String(remaining % 60).padStart(2, '0');
+    if (hours || days) {
+        clock = hours + ':' + clock;
+    }
+    return days ? days + (days === 1 ? ' day ' : ' days ') + clock : clock;
+}
+setInterval(function () {
+    document.querySelectorAll('[data-seconds-left]').forEach(function (timer) {
+        if (!timer.dataset.deadline) {
+            timer.dataset.deadline = Date.now() + timer.dataset.secondsLeft * 1000;
+        }
+        var remaining = Math.max(0, Math.round((timer.dataset.deadline - Date.now()) / 1000));
+        timer.textContent = formatCountdown(remaining);
+        if (remaining === 0 && timer.hasAttribute('data-reload')) {
+            timer.removeAttribute('data-reload');
+            window.location.reload();
+        }
+    });
+}, 1000);
+
+// buttons with data-clears empty the element with that ID when clicked, used to remove the last response before
+// submitting again
+document.addEventListener('click', function (event) {
+    var button = event.target.closest('[data-clears]');
+    if (button) {
+        document.getElementById(button.dataset.clears).innerHTML = '';
+    }
+});
+
+// after htmx swaps in the next question or an answer, focus moves to its heading or grade so keyboard and screen
+// reader users carry on from there, and the grade is read out through the live region on the quiz page
+document.addEventListener('htmx:afterSwap', function (event) {
+    var focus = event.detail.target.querySelector('[data-autofocus]');
+    if (focus) {
+        focus.focus();
+    }
+    var announcer = document.getElementById('announcer');
+    var announce = event.detail.target.querySelector('[data-announce]');
+    if (announcer && announce) {
+        announcer.textContent = announce.textContent.trim();
+    }
+});
+
+// quizzes with integrity checks are told how long the contestant spent away from the page, on another tab or window,
+// once they come back to it. The report goes with the question they were on, answered or not
+var awaySince = null;
+function leftPage() {
+    if (awaySince === null && document.querySelector('[data-integrity-report]')) {
+        awaySince = Date.now();
+    }
+}
+function returnedToPage() {
+    var report = document.querySelector('[data-integrity-report]');
+    if (awaySince === null || !report || document.visibilityState !== 'visible' || !document.hasFocus()) {
+        return;
+    }
+    var seconds = (Date.now() - awaySince) / 1000;
+    awaySince = null;
+    var question = report.querySelector('input[name="question"]');
+    var contestant = report.querySelector('input[name="contestant-id"]');
+    if (!question || !contestant || question.value === '0') {
+        return;
+    }
+    navigator.sendBeacon(report.dataset.integrityReport, new URLSearchParams({
+        'question': question.value,
+        'contestant-id': contestant.value,
+        'seconds': seconds.toFixed(1)
+    }));
+}
+document.addEventListener('visibilitychange', function () {
+    if (document.visibilityState === 'hidden') {
+        leftPage();
+    } else {
+        returnedToPage();
+    }
+});
+window.addEventListener('blur', leftPage);
+window.addEventListener('focus', returnedToPage);
+
+// registration forms with data-proof-of-work need a number that, added to the page's challenge, gives a SHA-256 hash
+// starting with that many zero bits. Finding one takes the browser a moment and makes registering in bulk expensive
+function leadingZeroBits(bytes) {
+    var zeros = 0;
+    for (var i = 0; i < bytes.length; i++) {
+        if (bytes[i] === 0) {
+            zeros += 8;
+            continue;
+        }
+        return zeros + Math.clz32(bytes[i]) - 24;
+    }
+    return zeros;
+}
+async function solveProofOfWork(challenge, bits) {
+    var encoder = new TextEncoder();
+    for (var solution = 0; ; solution++) {
+        var hash = await crypto.subtle.digest('SHA-256', encoder.encode(challenge + ':' + solution));
+        if (leadingZeroBits(new Uint8Array(hash)) >= bits) {
+            return String(solution);
+        }
+    }
+}
+document.addEventListener('submit', function (event) {
+    var form = event.target.closest('form[data-proof-of-work]');
+    var solution = form && form.querySelector('input[name="proof-of-work-solution"]');
+    // crypto.subtle is only there over HTTPS, without it the server turns the registration down
+    if (!solution || solution.value !== '' || !window.crypto.subtle) {
+        return;
+    }
+    event.preventDefault();
+    var button = form.querySelector('button[type="submit"]');
+    button.disabled = true;
+    button.textContent = form.dataset.checking;
+    var challenge = form.querySelector('input[name="proof-of-work-challenge"]').value;
+    solveProofOfWork(challenge, Number(form.dataset.proofOfWork)).then(function (found) {
+        solution.value = found;
+        form.submit();
+    });
+});
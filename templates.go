@@ -0,0 +1,112 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+//go:embed templates/*.html
+var embeddedTemplates embed.FS
+
+// the files each page is rendered from, pages render "base" and fragments render the template named after them
+var templatePages = map[string][]string{
+	"home":          {"base.html", "home.html"},
+	"quiz":          {"base.html", "quiz.html", "question.html", "round-intro.html"},
+	"question":      {"question.html", "round-intro.html"},
+	"scoreboard":    {"base.html", "scoreboard.html"},
+	"question-add":  {"base.html", "question-add.html"},
+	"question-bank": {"base.html", "question-bank.html"},
+	"analytics":     {"base.html", "analytics.html"},
+	"theme":         {"base.html", "theme.html"},
+	"review":        {"base.html", "review.html"},
+}
+
+// parsed templates for every page. In dev mode they are read from ./templates and parsed again whenever a file
+// changes, otherwise they come from the copy embedded in the binary and are parsed once
+type TemplateRegistry struct {
+	files    fs.FS
+	dev      bool
+	mu       sync.Mutex
+	pages    map[string]*template.Template
+	loadedAt time.Time
+}
+
+var pageTemplates *TemplateRegistry
+
+var templateFuncs = template.FuncMap{
+	"asset": assetPath,
+}
+
+func parseTemplatePages(files fs.FS) (map[string]*template.Template, error) {
+	pages := map[string]*template.Template{}
+	for page, names := range templatePages {
+		tmpl, err := template.New(names[0]).Funcs(templateFuncs).ParseFS(files, names...)
+		if err != nil {
+			return nil, fmt.Errorf("parsing templates for %s: %w", page, err)
+		}
+		pages[page] = tmpl
+	}
+	return pages, nil
+}
+
+// parses every page up front so a broken template stops the server starting rather than failing a request
+func newTemplateRegistry(dev bool) (*TemplateRegistry, error) {
+	registry := &TemplateRegistry{dev: dev}
+	registry.files, _ = fs.Sub(embeddedTemplates, "templates")
+	if dev {
+		registry.files = os.DirFS("./templates")
+	}
+
+	pages, err := parseTemplatePages(registry.files)
+	if err != nil {
+		return nil, err
+	}
+	registry.pages = pages
+	registry.loadedAt = time.Now()
+	return registry, nil
+}
+
+// the newest modification time of the template files, only used in dev mode
+func (registry *TemplateRegistry) lastChanged() time.Time {
+	var latest time.Time
+	entries, err := fs.ReadDir(registry.files, ".")
+	if err != nil {
+		return latest
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+// the parsed templates for the page, in dev mode any changes to the files are picked up first
+func (registry *TemplateRegistry) get(page string) (*template.Template, error) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	if registry.dev && registry.lastChanged().After(registry.loadedAt) {
+		pages, err := parseTemplatePages(registry.files)
+		if err != nil {
+			// tried again on every request until the file is fixed
+			return nil, err
+		}
+		slog.Info("Reloaded templates")
+		registry.pages = pages
+		registry.loadedAt = time.Now()
+	}
+
+	tmpl, found := registry.pages[page]
+	if !found {
+		return nil, fmt.Errorf("no templates for page %s", page)
+	}
+	return tmpl, nil
+}
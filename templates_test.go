@@ -0,0 +1,202 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// go test -run TestTemplates -update writes the rendered pages to testdata/golden after a deliberate template change
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// renders with fixed asset URLs so the golden files don't change whenever quiz.css or quiz.js do
+func useTestAssets(t *testing.T) {
+	t.Helper()
+	previous := staticAssets
+	staticAssets = &StaticAssets{urls: map[string]string{
+		"quiz.css":    "/static/quiz.css",
+		"htmx.min.js": "/static/htmx.min.js",
+		"quiz.js":     "/static/quiz.js",
+	}}
+	t.Cleanup(func() { staticAssets = previous })
+}
+
+func renderTemplate(t *testing.T, page string, name string, values map[string]interface{}) string {
+	t.Helper()
+	registry, err := newTemplateRegistry(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := registry.get(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rendered strings.Builder
+	if err := tmpl.ExecuteTemplate(&rendered, name, values); err != nil {
+		t.Fatalf("rendering %s: %v", page, err)
+	}
+	return rendered.String()
+}
+
+func compareGolden(t *testing.T, name string, rendered string) {
+	t.Helper()
+	path := filepath.Join("testdata", "golden", name+".html")
+	if *updateGolden {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(rendered), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	golden, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v, run go test -update to create it", err)
+	}
+	if string(golden) != rendered {
+		t.Errorf("%s doesn't match %s, run go test -update if the change is deliberate. Got:\n%s", name, path, rendered)
+	}
+}
+
+func testQuestionValues(locale string) map[string]interface{} {
+	return map[string]interface{}{
+		"QuizTitle": "Christmas",
+		"QuizId":    "christmas",
+		"T":         Translator{Locale: locale},
+		"Theme":     Theme{},
+		"OrgPath":   "",
+		"Group":     "legal",
+		"Question": Question{
+			QuestionId:     7,
+			Order:          2,
+			QuestionText:   "What is three times three",
+			Answers:        []Answer{{1, "6"}, {2, "9"}, {3, "12"}, {4, "33"}},
+			CorrectAnswer:  2,
+			TotalQuestions: 3,
+			Points:         1,
+			Round:          Round{RoundId: 1, Title: "Warm up", Multiplier: 1, TimeLimit: 60},
+			RoundNumber:    1,
+			TotalRounds:    2,
+			SecondsLeft:    42,
+			Timed:          true,
+		},
+		"Contestant":       "Y29udGVzdGFudA==",
+		"PreviousQuestion": 1,
+	}
+}
+
+func answered(values map[string]interface{}, selected int, correct bool, gradeText string) map[string]interface{} {
+	values["Answer"] = true
+	values["Selected"] = selected
+	values["Correct"] = correct
+	values["GradeText"] = gradeText
+	return values
+}
+
+var (
+	radioIds  = regexp.MustCompile(`<input type="radio" name="answers" id="(answer_\d+)"`)
+	h1Tag     = regexp.MustCompile(`<h1[^>]*>`)
+	gradeLine = regexp.MustCompile(`<p class="grade"[^>]*>`)
+)
+
+// the checks for screen reader and keyboard users, on top of the golden files so a regenerated file can't lose them
+func checkAccessibility(t *testing.T, rendered string, answered bool) {
+	t.Helper()
+	expectContains(t, "answers are grouped", rendered, `<fieldset class="answers">`, "<legend>What is three times three?</legend>")
+
+	ids := radioIds.FindAllStringSubmatch(rendered, -1)
+	if len(ids) != 4 {
+		t.Errorf("got %d answer radios, want 4", len(ids))
+	}
+	for _, id := range ids {
+		expectContains(t, "every answer is labelled", rendered, `<label for="`+id[1]+`"`)
+	}
+
+	heading := h1Tag.FindString(rendered)
+	grade := gradeLine.FindString(rendered)
+	if answered {
+		if strings.Contains(heading, "data-autofocus") {
+			t.Errorf("answered question's heading %s shouldn't take focus from the grade", heading)
+		}
+		if !strings.Contains(grade, "data-autofocus") || !strings.Contains(grade, "data-announce") || !strings.Contains(grade, `tabindex="-1"`) {
+			t.Errorf("grade %q should take focus and be announced", grade)
+		}
+		// the tick and cross are decoration, the hidden text says the same for screen readers
+		expectContains(t, "correct answer mark", rendered,
+			`<span class="answer-mark" aria-hidden="true">&#10003;</span><span class="visually-hidden">(correct answer)</span>`)
+		if strings.Contains(rendered, "role=\"timer\"") {
+			t.Error("answered question shouldn't show the round timer")
+		}
+	} else {
+		if !strings.Contains(heading, "data-autofocus") || !strings.Contains(heading, `tabindex="-1"`) {
+			t.Errorf("new question's heading %s should take focus", heading)
+		}
+		if grade != "" {
+			t.Errorf("unanswered question has a grade %s", grade)
+		}
+		expectContains(t, "round timer", rendered, `role="timer" data-seconds-left="42"`)
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	useTestAssets(t)
+
+	t.Run("quiz page", func(t *testing.T) {
+		rendered := renderTemplate(t, "quiz", "base", testQuestionValues("en"))
+		compareGolden(t, "quiz-page", rendered)
+		checkAccessibility(t, rendered, false)
+		expectContains(t, "page", rendered, `<html lang="en">`,
+			`<div id="announcer" class="visually-hidden" role="status" aria-live="polite"></div>`,
+			`action="/record-answer/" method="POST"`)
+	})
+
+	t.Run("answered correctly", func(t *testing.T) {
+		rendered := renderTemplate(t, "question", "question", answered(testQuestionValues("en"), 2, true, "Correct! Well done"))
+		compareGolden(t, "question-correct", rendered)
+		checkAccessibility(t, rendered, true)
+		if strings.Contains(rendered, "<html") || strings.Contains(rendered, `id="announcer"`) {
+			t.Error("the fragment htmx swaps in should only be the question")
+		}
+	})
+
+	t.Run("answered wrongly on the last question", func(t *testing.T) {
+		values := answered(testQuestionValues("en"), 1, false, "Incorrect! Never mind")
+		question := values["Question"].(Question)
+		question.Order = 3
+		values["Question"] = question
+		values["EstimateQuestion"] = "How many sprouts were eaten"
+		rendered := renderTemplate(t, "question", "question", values)
+		compareGolden(t, "question-incorrect-last", rendered)
+		checkAccessibility(t, rendered, true)
+		expectContains(t, "last question", rendered, `action="/scoreboard/christmas/legal/?c=Y29udGVzdGFudA%3d%3d" method="POST"`,
+			`<label for="estimate">`,
+			`<span class="answer-mark" aria-hidden="true">&#10007;</span><span class="visually-hidden">(your answer)</span>`)
+	})
+
+	t.Run("round intro", func(t *testing.T) {
+		values := testQuestionValues("en")
+		values["RoundIntro"] = true
+		rendered := renderTemplate(t, "quiz", "base", values)
+		compareGolden(t, "round-intro", rendered)
+		expectContains(t, "round intro", rendered, `<h1 tabindex="-1" data-autofocus>Warm up</h1>`, `name="round-intro" value="seen"`)
+	})
+
+	t.Run("integrity checks", func(t *testing.T) {
+		values := testQuestionValues("en")
+		values["IntegrityChecks"] = true
+		rendered := renderTemplate(t, "quiz", "base", values)
+		expectContains(t, "integrity checks", rendered, `<div id="question" data-integrity-report="/integrity/">`,
+			"This quiz notes when you leave the page while answering")
+	})
+
+	t.Run("translated page", func(t *testing.T) {
+		rendered := renderTemplate(t, "quiz", "base", testQuestionValues("fr"))
+		compareGolden(t, "quiz-page-fr", rendered)
+		checkAccessibility(t, rendered, false)
+		expectContains(t, "page", rendered, `<html lang="fr">`)
+	})
+}
@@ -0,0 +1,547 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// how a quiz looks and what contestants are told after each answer. Anything left empty comes from the preset
+type Theme struct {
+	Preset string
+	// keyed by the names in themeColours
+	Colours            map[string]string
+	Font               string
+	LogoUrl            string
+	BackgroundImageUrl string
+	// where base.html loads the theme's stylesheet from
+	Stylesheet string
+}
+
+// the colours a theme can change and the CSS variables in quiz.css they set
+var themeColours = []struct {
+	Name        string
+	CssVariable string
+}{
+	{"background", "--color-darkest"},
+	{"panel", "--color-dark"},
+	{"text", "--color-light"},
+	{"accent", "--color-green"},
+	{"accent-dark", "--color-dark-green"},
+	{"error", "--color-red"},
+}
+
+// fonts are picked from a list rather than typed in so the stylesheet only ever contains font stacks we wrote
+var themeFonts = map[string]string{
+	"system":      `-apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, Oxygen, Ubuntu, Cantarell, "Open Sans", "Helvetica Neue", sans-serif`,
+	"serif":       `Georgia, Cambria, "Times New Roman", Times, serif`,
+	"rounded":     `ui-rounded, "SF Pro Rounded", Nunito, "Varela Round", sans-serif`,
+	"monospace":   `ui-monospace, "SF Mono", Menlo, Consolas, "Liberation Mono", monospace`,
+	"handwriting": `"Comic Sans MS", "Chalkboard SE", "Comic Neue", cursive`,
+}
+
+type ThemePreset struct {
+	Colours           map[string]string
+	Font              string
+	CorrectMessages   []string
+	IncorrectMessages []string
+}
+
+// quizzes without a theme use the classic preset, quizzes created before themes existed were given the christmas one
+const defaultThemePreset = "classic"
+
+var themePresets = map[string]ThemePreset{
+	"classic": {
+		Colours: map[string]string{
+			"background": "#1f2933", "panel": "#3e4c59", "text": "#f5f7fa",
+			"accent": "#2f80ed", "accent-dark": "#1c3d6e", "error": "#e12d39",
+		},
+		Font: "system",
+		CorrectMessages: []string{
+			"Well done, you're smarter than you look",
+			"Come on, that was a lucky guess wasn't it? I won't tell anyone...",
+			"Way to go",
+			"Your knowledge is impressive",
+		},
+		IncorrectMessages: []string{
+			"Better luck with the next one",
+			"You may get replaced by ChatGPT at this rate...",
+			"How did you not know that?!?",
+			"So close, or maybe not",
+		},
+	},
+	"christmas": {
+		Colours: map[string]string{
+			"background": "#343a40", "panel": "#495057", "text": "#f1f3f5",
+			"accent": "#5D9C59", "accent-dark": "#113622", "error": "#DF2E38",
+		},
+		Font: "system",
+		CorrectMessages: []string{
+			"Well done, you're smarter than you look",
+			"Come on, that was a lucky guess wasn't it? I won't tell anyone...",
+			"Way to go",
+			"Your knowledge is impressive",
+			"Even Santa couldn't answer that one!",
+		},
+		IncorrectMessages: []string{
+			"Better luck with the next one",
+			"Rudolph could have answered it",
+			"You may get replaced by ChatGPT at this rate...",
+			"How did you not know that?!?",
+			"You've made the elves cry",
+		},
+	},
+	"halloween": {
+		Colours: map[string]string{
+			"background": "#1b1523", "panel": "#3a2d4a", "text": "#fdf0d5",
+			"accent": "#e36414", "accent-dark": "#5f2c0b", "error": "#9d0208",
+		},
+		Font: "handwriting",
+		CorrectMessages: []string{
+			"Spooky good",
+			"The ghosts are impressed",
+			"A treat for you",
+		},
+		IncorrectMessages: []string{
+			"That's a trick, not a treat",
+			"Even the zombies knew that one",
+			"The bats are disappointed",
+		},
+	},
+	"ocean": {
+		Colours: map[string]string{
+			"background": "#0b3954", "panel": "#087e8b", "text": "#f4f9f9",
+			"accent": "#2a9d8f", "accent-dark": "#05386b", "error": "#ff5a5f",
+		},
+		Font: "rounded",
+		CorrectMessages: []string{
+			"Making waves",
+			"You're swimming along nicely",
+			"Shipshape",
+		},
+		IncorrectMessages: []string{
+			"Lost at sea on that one",
+			"Sunk, but there's plenty more questions in the sea",
+			"Back to shore for that one",
+		},
+	},
+}
+
+const (
+	feedbackCorrect   = "correct"
+	feedbackIncorrect = "incorrect"
+)
+
+var themeColourPattern = regexp.MustCompile(`^#(?:[0-9A-Fa-f]{3}|[0-9A-Fa-f]{6})$`)
+
+func themePresetNames() []string {
+	var names []string
+	for name := range themePresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func themeFontNames() []string {
+	var names []string
+	for name := range themeFonts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// image URLs end up in the stylesheet and img tags, so only absolute https URLs and paths on this server are allowed
+// and nothing that could break out of url("...")
+func validateThemeImageUrl(value string) error {
+	if value == "" {
+		return nil
+	}
+	if strings.ContainsAny(value, "\"'()\\ \t\r\n<>") {
+		return fmt.Errorf("image URL can't contain quotes, brackets or spaces, got %q", value)
+	}
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return fmt.Errorf("can't read image URL %q: %w", value, err)
+	}
+	if parsed.Scheme == "https" && parsed.Host != "" {
+		return nil
+	}
+	if parsed.Scheme == "" && parsed.Host == "" && strings.HasPrefix(value, "/") && !strings.HasPrefix(value, "//") {
+		return nil
+	}
+	return fmt.Errorf("image URL must start with https:// or /, got %q", value)
+}
+
+func validateTheme(theme Theme) error {
+	if _, found := themePresets[theme.Preset]; !found {
+		return fmt.Errorf("preset must be one of %s, got %q", strings.Join(themePresetNames(), ", "), theme.Preset)
+	}
+	for _, colour := range themeColours {
+		value := theme.Colours[colour.Name]
+		if value != "" && !themeColourPattern.MatchString(value) {
+			return fmt.Errorf("%s colour must be a hex colour like #1f2933, got %q", colour.Name, value)
+		}
+	}
+	if _, found := themeFonts[theme.Font]; theme.Font != "" && !found {
+		return fmt.Errorf("font must be one of %s, got %q", strings.Join(themeFontNames(), ", "), theme.Font)
+	}
+	if err := validateThemeImageUrl(theme.LogoUrl); err != nil {
+		return err
+	}
+	return validateThemeImageUrl(theme.BackgroundImageUrl)
+}
+
+// the colour used for the theme, falling back to the preset's
+func (theme Theme) colour(name string) string {
+	if value := theme.Colours[name]; value != "" {
+		return value
+	}
+	return themePresets[theme.Preset].Colours[name]
+}
+
+func (theme Theme) fontStack() string {
+	if theme.Font != "" {
+		return themeFonts[theme.Font]
+	}
+	return themeFonts[themePresets[theme.Preset].Font]
+}
+
+// the stylesheet that overrides the variables in quiz.css, the theme must have been validated first
+func (theme Theme) css() string {
+	var css strings.Builder
+	css.WriteString(":root {\n")
+	for _, colour := range themeColours {
+		fmt.Fprintf(&css, "    %s: %s;\n", colour.CssVariable, theme.colour(colour.Name))
+	}
+	fmt.Fprintf(&css, "    --font-family: %s;\n", theme.fontStack())
+	if theme.BackgroundImageUrl != "" {
+		fmt.Fprintf(&css, "    --background-image: url(\"%s\");\n", theme.BackgroundImageUrl)
+	}
+	css.WriteString("}\n")
+	return css.String()
+}
+
+// the theme's settings as form or query values, used for the preview stylesheet
+func (theme Theme) values() url.Values {
+	values := url.Values{}
+	values.Set("preset", theme.Preset)
+	for _, colour := range themeColours {
+		if value := theme.Colours[colour.Name]; value != "" {
+			values.Set(colour.Name, value)
+		}
+	}
+	for name, value := range map[string]string{"font": theme.Font, "logo_url": theme.LogoUrl, "background_image_url": theme.BackgroundImageUrl} {
+		if value != "" {
+			values.Set(name, value)
+		}
+	}
+	return values
+}
+
+// reads a theme from submitted form or query values
+func themeFromValues(values url.Values) Theme {
+	theme := Theme{
+		Preset:             strings.TrimSpace(values.Get("preset")),
+		Colours:            map[string]string{},
+		Font:               strings.TrimSpace(values.Get("font")),
+		LogoUrl:            strings.TrimSpace(values.Get("logo_url")),
+		BackgroundImageUrl: strings.TrimSpace(values.Get("background_image_url")),
+	}
+	for _, colour := range themeColours {
+		theme.Colours[colour.Name] = strings.TrimSpace(values.Get(colour.Name))
+	}
+	return theme
+}
+
+func getTheme(quizId string) (Theme, error) {
+	theme := Theme{Preset: defaultThemePreset, Colours: map[string]string{}}
+	rows, err := makeDatabaseQuery(`SELECT preset, background_colour, panel_colour, text_colour, accent_colour,
+		accent_dark_colour, error_colour, font, logo_url, background_image_url FROM quiz_themes WHERE quiz_id = ?`, quizId)
+	if err != nil || len(rows) == 0 {
+		return theme, err
+	}
+
+	row := rows[0]
+	theme.Preset = row["preset"].(string)
+	for _, colour := range themeColours {
+		theme.Colours[colour.Name], _ = row[strings.ReplaceAll(colour.Name, "-", "_")+"_colour"].(string)
+	}
+	theme.Font, _ = row["font"].(string)
+	theme.LogoUrl, _ = row["logo_url"].(string)
+	theme.BackgroundImageUrl, _ = row["background_image_url"].(string)
+	return theme, nil
+}
+
+func saveTheme(quizId string, theme Theme) error {
+	if err := validateTheme(theme); err != nil {
+		return err
+	}
+	// empty values are stored as NULL so they follow the preset
+	nullable := func(value string) interface{} {
+		if value == "" {
+			return nil
+		}
+		return value
+	}
+
+	_, err := makeDatabaseQuery(`INSERT OR REPLACE INTO quiz_themes(quiz_id, preset, background_colour, panel_colour,
+		text_colour, accent_colour, accent_dark_colour, error_colour, font, logo_url, background_image_url)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		quizId, theme.Preset, nullable(theme.Colours["background"]), nullable(theme.Colours["panel"]),
+		nullable(theme.Colours["text"]), nullable(theme.Colours["accent"]), nullable(theme.Colours["accent-dark"]),
+		nullable(theme.Colours["error"]), nullable(theme.Font), nullable(theme.LogoUrl), nullable(theme.BackgroundImageUrl))
+	return err
+}
+
+// the quiz's own messages for correct or incorrect answers, empty if it uses its preset's
+func quizFeedbackMessages(quizId string, kind string) ([]string, error) {
+	rows, err := makeDatabaseQuery("SELECT message FROM quiz_feedback WHERE quiz_id = ? AND kind = ? ORDER BY feedback_id", quizId, kind)
+	if err != nil {
+		return nil, err
+	}
+	var messages []string
+	for _, row := range rows {
+		messages = append(messages, row["message"].(string))
+	}
+	return messages, nil
+}
+
+// replaces the quiz's messages for correct or incorrect answers, no messages goes back to the preset's
+func setFeedbackMessages(quizId string, kind string, messages []string) error {
+	if kind != feedbackCorrect && kind != feedbackIncorrect {
+		return fmt.Errorf("feedback must be for %s or %s answers, got %q", feedbackCorrect, feedbackIncorrect, kind)
+	}
+
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM quiz_feedback WHERE quiz_id = ? AND kind = ?", quizId, kind); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, message := range messages {
+		message = strings.TrimSpace(message)
+		if message == "" {
+			continue
+		}
+		if _, err := tx.Exec("INSERT INTO quiz_feedback(quiz_id, kind, message) VALUES (?, ?, ?)", quizId, kind, message); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// the messages contestants see for a correct or incorrect answer, the quiz's own or its preset's
+func feedbackMessages(quizId string, kind string, theme Theme) ([]string, error) {
+	messages, err := quizFeedbackMessages(quizId, kind)
+	if err != nil || len(messages) > 0 {
+		return messages, err
+	}
+	if kind == feedbackCorrect {
+		return themePresets[theme.Preset].CorrectMessages, nil
+	}
+	return themePresets[theme.Preset].IncorrectMessages, nil
+}
+
+// picks one of the quiz's messages for a correct or incorrect answer to show after the answer. The preset's messages
+// are translated, the quiz's own are shown as they were written
+func randomFeedback(quizId string, kind string, translator Translator) string {
+	theme, err := getTheme(quizId)
+	if err != nil {
+		slog.Error("Error getting theme", "quiz_id", quizId, "error", err)
+	}
+	messages, err := quizFeedbackMessages(quizId, kind)
+	if err != nil {
+		slog.Error("Error getting feedback messages", "quiz_id", quizId, "error", err)
+	}
+	if len(messages) == 0 {
+		messages = translator.List("feedback." + theme.Preset + "." + kind)
+	}
+	if len(messages) == 0 {
+		messages, _ = feedbackMessages(quizId, kind, theme)
+	}
+	if len(messages) == 0 {
+		return ""
+	}
+	return messages[rand.Intn(len(messages))]
+}
+
+func themeStylesheetPath(r *http.Request, quizId string) string {
+	return requestOrganisation(r).BasePath + "/theme/" + publicQuizId(quizId) + "/theme.css"
+}
+
+// the quiz's theme ready to pass to base.html, falling back to the default if it can't be read
+func requestTheme(r *http.Request, quizId string) Theme {
+	theme, err := getTheme(quizId)
+	if err != nil {
+		requestLogger(r).Error("Error getting theme", "quiz_id", quizId, "error", err)
+	}
+	theme.Stylesheet = themeStylesheetPath(r, quizId)
+	return theme
+}
+
+// handles GET /theme/{quiz}/theme.css, the stylesheet for the quiz's theme. With a preview query the theme in the
+// query is used instead, which is how the theme page previews changes before they are saved
+func themeStylesheetHandler(w http.ResponseWriter, r *http.Request) {
+	quizId := quizFromPath(r)
+	theme, err := getTheme(quizId)
+	if err != nil {
+		requestLogger(r).Error("Error getting theme", "quiz_id", quizId, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if r.URL.Query().Has("preview") {
+		theme = themeFromValues(r.URL.Query())
+		if err := validateTheme(theme); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	css := theme.css()
+	sum := sha256.Sum256([]byte(css))
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	// themes can change at any time, so browsers check for a new version rather than caching it
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "text/css; charset=utf-8")
+	fmt.Fprint(w, css)
+}
+
+// handles GET and POST /theme/{quiz}/, where admins pick the quiz's theme and feedback messages. Previewing submits
+// the form with GET so the page is shown in the unsaved theme
+func themeHandler(w http.ResponseWriter, r *http.Request) {
+	quizId := quizFromPath(r)
+	var message string
+	var showError bool
+
+	theme, err := getTheme(quizId)
+	if err != nil {
+		requestLogger(r).Error("Error getting theme", "quiz_id", quizId, "error", err)
+	}
+	correctMessages, err := quizFeedbackMessages(quizId, feedbackCorrect)
+	if err != nil {
+		requestLogger(r).Error("Error getting feedback messages", "quiz_id", quizId, "error", err)
+	}
+	incorrectMessages, err := quizFeedbackMessages(quizId, feedbackIncorrect)
+	if err != nil {
+		requestLogger(r).Error("Error getting feedback messages", "quiz_id", quizId, "error", err)
+	}
+
+	submitted := r.Method == "POST" || r.URL.Query().Has("preview")
+	if submitted {
+		r.ParseForm()
+		theme = themeFromValues(r.Form)
+		correctMessages = nonEmpty(strings.Split(r.Form.Get("correct_messages"), "\n"), nil)
+		incorrectMessages = nonEmpty(strings.Split(r.Form.Get("incorrect_messages"), "\n"), nil)
+		if err := validateTheme(theme); err != nil {
+			message = err.Error()
+			showError = true
+		}
+	}
+
+	if r.Method == "POST" && !showError {
+		err := saveTheme(quizId, theme)
+		if err == nil {
+			err = setFeedbackMessages(quizId, feedbackCorrect, correctMessages)
+		}
+		if err == nil {
+			err = setFeedbackMessages(quizId, feedbackIncorrect, incorrectMessages)
+		}
+		if err != nil {
+			requestLogger(r).Error("Error saving theme", "quiz_id", quizId, "error", err)
+			message = "There was a problem saving the theme"
+			showError = true
+		} else {
+			message = "Theme saved"
+			recordWebAudit(r, "theme update", quizId, "preset "+theme.Preset)
+		}
+	}
+
+	theme.Stylesheet = themeStylesheetPath(r, quizId)
+	if submitted && !showError {
+		// the page is shown in the theme from the form, whether it has been saved or is only being previewed
+		preview := theme.values()
+		preview.Set("preview", "1")
+		theme.Stylesheet += "?" + preview.Encode()
+	}
+
+	var presetColours = map[string]map[string]string{}
+	for name, preset := range themePresets {
+		presetColours[name] = preset.Colours
+	}
+	sampleCorrect, _ := feedbackMessages(quizId, feedbackCorrect, theme)
+	sampleIncorrect, _ := feedbackMessages(quizId, feedbackIncorrect, theme)
+	if submitted {
+		sampleCorrect = nonEmpty(correctMessages, themePresets[theme.Preset].CorrectMessages)
+		sampleIncorrect = nonEmpty(incorrectMessages, themePresets[theme.Preset].IncorrectMessages)
+	}
+
+	tmpl, err := pageTemplates.get("theme")
+	if err != nil {
+		requestLogger(r).Error("Error rendering template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+		"QuizTitle":         publicQuizId(quizId) + " theme",
+		"QuizId":            publicQuizId(quizId),
+		"OrgPath":           requestOrganisation(r).BasePath,
+		"Theme":             theme,
+		"Colours":           themeColours,
+		"Presets":           themePresetNames(),
+		"Fonts":             themeFontNames(),
+		"PresetColours":     presetColours,
+		"CorrectMessages":   strings.Join(correctMessages, "\n"),
+		"IncorrectMessages": strings.Join(incorrectMessages, "\n"),
+		"SampleCorrect":     firstOr(sampleCorrect, ""),
+		"SampleIncorrect":   firstOr(sampleIncorrect, ""),
+		"Message":           message,
+		"ShowError":         showError,
+	})
+	if err != nil {
+		requestLogger(r).Error("Error rendering template", "error", err)
+	}
+}
+
+// the messages with blank lines dropped, or the fallback if there are none left
+func nonEmpty(messages []string, fallback []string) []string {
+	var kept []string
+	for _, message := range messages {
+		if strings.TrimSpace(message) != "" {
+			kept = append(kept, strings.TrimSpace(message))
+		}
+	}
+	if len(kept) == 0 {
+		return fallback
+	}
+	return kept
+}
+
+func firstOr(values []string, fallback string) string {
+	if len(values) == 0 {
+		return fallback
+	}
+	return values[0]
+}